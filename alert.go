@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/BestPrice/backend/http"
+)
+
+// alertBatch is the number of triggered alerts delivered per round.
+const alertBatch = 100
+
+// alertDelay is how long price changes are gathered before a round.
+const alertDelay = time.Second
+
+// alertWorker periodically evaluates the price alerts and delivers the
+// triggered ones to the webhook, if there is one. Price changes received
+// on Events start a round early.
+type alertWorker struct {
+	Alerts   bp.AlertService
+	Webhook  *http.Webhook
+	Interval time.Duration
+	Events   <-chan bp.Event
+}
+
+func (w *alertWorker) Run() {
+	var (
+		tick = time.NewTicker(w.Interval)
+		soon <-chan time.Time
+	)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-soon:
+		case e, ok := <-w.Events:
+			if !ok {
+				w.Events = nil
+			} else if e.Price() && soon == nil {
+				soon = time.After(alertDelay)
+			}
+			continue
+		}
+		soon = nil
+		if err := w.round(); err != nil {
+			log.Println("alertWorker:", err)
+		}
+	}
+}
+
+func (w *alertWorker) round() error {
+	n, err := w.Alerts.EvaluateAlerts()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("alertWorker: %d alerts triggered", n)
+	}
+	if w.Webhook == nil {
+		return nil
+	}
+
+	for {
+		pending, err := w.Alerts.PendingAlerts(alertBatch)
+		if err != nil {
+			return err
+		}
+		// undelivered alerts stay in the outbox for the next round
+		for _, a := range pending {
+			if err := w.Webhook.Send(a); err != nil {
+				return err
+			}
+			if err := w.Alerts.MarkDelivered(a.ID); err != nil {
+				return err
+			}
+		}
+		if len(pending) < alertBatch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package bp
+
+import (
+	"errors"
+	"strings"
+)
+
+// ConflictError is returned when a change would break the catalog, like
+// deleting a category that still has products.
+type ConflictError string
+
+func (e ConflictError) Error() string {
+	return string(e)
+}
+
+func (c *Category) Valid() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("name must be set")
+	}
+	return nil
+}
+
+func (p *Product) Valid() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("name must be set")
+	}
+	if p.IDCategory.Null() {
+		return errors.New("category must be set")
+	}
+	if p.Brand.ID.Null() {
+		return errors.New("brand must be set")
+	}
+	if !p.PriceDescription.Valid || p.PriceDescription.String == "" {
+		return errors.New("price description must be set")
+	}
+	if p.Weight.Valid && p.Weight.Int64 <= 0 || p.Volume.Valid && p.Volume.Int64 <= 0 {
+		return errors.New("weight and volume must be positive")
+	}
+	return nil
+}
+
+func (b *Brand) Valid() error {
+	if strings.TrimSpace(b.Name) == "" {
+		return errors.New("name must be set")
+	}
+	return nil
+}
+
+func (c *Chainstore) Valid() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("name must be set")
+	}
+	return nil
+}
+
+func (s *Store) Valid() error {
+	if s.IDChainStore.Null() {
+		return errors.New("chain store must be set")
+	}
+	l := Location{Lat: s.Lat, Lng: s.Lng}
+	return l.Valid()
+}
@@ -0,0 +1,47 @@
+package bp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrNotFound is returned when the requested item does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Alert is a subscription to the price of a product dropping to the target
+// price, optionally only in the given chain stores.
+type Alert struct {
+	ID            ID              `json:"id_alert"`
+	IDProduct     ID              `json:"id_product"`
+	IDChainStores []ID            `json:"id_chain_stores"`
+	TargetPrice   decimal.Decimal `json:"target_price"`
+	Subscriber    string          `json:"subscriber"`
+	Created       time.Time       `json:"created_at"`
+}
+
+func (a *Alert) Valid() error {
+	if a.IDProduct.Null() {
+		return errors.New("product must be set")
+	}
+	if a.TargetPrice.Cmp(decimal.Zero) <= 0 {
+		return errors.New("target price must be positive")
+	}
+	if a.Subscriber == "" {
+		return errors.New("subscriber must be set")
+	}
+	return nil
+}
+
+// TriggeredAlert is an alert whose product was seen at or below the target
+// price, waiting in the outbox to be delivered.
+type TriggeredAlert struct {
+	ID           int64           `json:"id"`
+	Alert        Alert           `json:"alert"`
+	Product      string          `json:"product_name"`
+	IDChainStore ID              `json:"id_chain_store"`
+	ChainStore   string          `json:"chain_store_name"`
+	Price        decimal.Decimal `json:"price"`
+	Triggered    time.Time       `json:"triggered_at"`
+}
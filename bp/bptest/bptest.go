@@ -0,0 +1,676 @@
+// Package bptest checks implementations of bp.Service against a shared
+// demo fixture, so the in-memory and the database services behave alike.
+package bptest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/shopspring/decimal"
+)
+
+// ids of the demo fixture
+const (
+	biedronka = "10000000-0000-4000-8000-000000000001"
+	lidl      = "10000000-0000-4000-8000-000000000002"
+	auchan    = "10000000-0000-4000-8000-000000000003"
+
+	nabial   = "30000000-0000-4000-8000-000000000001"
+	mleko    = "30000000-0000-4000-8000-000000000002"
+	maslo    = "30000000-0000-4000-8000-000000000003"
+	slodycze = "30000000-0000-4000-8000-000000000004"
+	maka     = "30000000-0000-4000-8000-000000000005"
+
+	laciate    = "40000000-0000-4000-8000-000000000001"
+	uht        = "40000000-0000-4000-8000-000000000002"
+	maslo200   = "40000000-0000-4000-8000-000000000003"
+	gouda      = "40000000-0000-4000-8000-000000000004"
+	czekolada  = "40000000-0000-4000-8000-000000000005"
+	kefir      = "40000000-0000-4000-8000-000000000006"
+	laciateBox = "40000000-0000-4000-8000-000000000007"
+	maka500    = "40000000-0000-4000-8000-000000000008"
+	maka1      = "40000000-0000-4000-8000-000000000009"
+	maka2      = "40000000-0000-4000-8000-00000000000a"
+	makaLuz    = "40000000-0000-4000-8000-00000000000b"
+
+	lidlPowisle = "50000000-0000-4000-8000-000000000002"
+)
+
+// Hostile phrases must be searched by their words only, they break queries
+// built by splicing the phrase into SQL or into a pattern.
+var Hostile = []string{
+	`'`,
+	`mleko' OR '1'='1`,
+	`'; DROP TABLE product; --`,
+	`%_`,
+	`.*[a-z]+\`,
+	`mleko:* & !ser`,
+	`(a|b) <-> c`,
+	"mle\x00ko",
+	"́",
+}
+
+func id(hex string) bp.ID {
+	id, err := bp.NewID(hex)
+	if err != nil {
+		panic(err)
+	}
+	return *id
+}
+
+func dec(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+type checker struct {
+	s    bp.Service
+	errs []string
+}
+
+func (c *checker) errorf(format string, args ...interface{}) {
+	c.errs = append(c.errs, fmt.Sprintf(format, args...))
+}
+
+// TestService checks s serves the catalog of bp.DemoFixture, it returns an error
+// listing every failed check. Price history periods are expected in UTC.
+func TestService(s bp.Service) error {
+	c := &checker{s: s}
+	c.chainstores()
+	c.stores()
+	c.categories()
+	c.products()
+	c.shop()
+	c.history()
+	if len(c.errs) > 0 {
+		return errors.New(strings.Join(c.errs, "\n"))
+	}
+	return nil
+}
+
+func (c *checker) chainstores() {
+	vals, err := c.s.Chainstores()
+	if err != nil {
+		c.errorf("Chainstores: %v", err)
+		return
+	}
+	want := map[string]string{biedronka: "Biedronka", lidl: "Lidl", auchan: "Auchan"}
+	got := make(map[string]string)
+	for _, cs := range vals {
+		got[cs.ID.String()] = cs.Name
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		c.errorf("Chainstores: got %v, want %v", got, want)
+	}
+}
+
+func (c *checker) stores() {
+	vals, err := c.s.Stores()
+	if err != nil {
+		c.errorf("Stores: %v", err)
+		return
+	}
+	if len(vals) != 4 {
+		c.errorf("Stores: got %d stores, want 4", len(vals))
+	}
+	for _, st := range vals {
+		if st.ID.String() == lidlPowisle &&
+			(st.IDChainStore.String() != lidl || st.CSName.String != "Lidl" || st.City.String != "Warszawa") {
+			c.errorf("Stores: got %+v for Lidl Powiśle", st)
+		}
+	}
+}
+
+// tree returns the names of categories indented by their depth, siblings
+// sorted by name.
+func tree(cats []bp.Category, parent string, depth int) []string {
+	var vals []string
+	for _, cat := range cats {
+		p := ""
+		if !cat.IDParent.Null() {
+			p = cat.IDParent.String()
+		}
+		line := strings.Repeat(" ", depth) + cat.Name
+		if p != parent {
+			line += " (wrong parent)"
+		}
+		vals = append(vals, strings.Join(append([]string{line},
+			tree(cat.Subcategories, cat.ID.String(), depth+1)...), "\n"))
+	}
+	sort.Strings(vals)
+	return vals
+}
+
+func (c *checker) categories() {
+	vals, err := c.s.Categories()
+	if err != nil {
+		c.errorf("Categories: %v", err)
+		return
+	}
+	got := strings.Join(tree(vals, "", 0), "\n")
+	want := "Mąka\nNabiał\n Masło\n Mleko\nSłodycze"
+	if got != want {
+		c.errorf("Categories: got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func (c *checker) search(q bp.ProductQuery) ([]bp.Product, bool) {
+	vals, err := c.s.Products(q)
+	if err != nil {
+		c.errorf("Products(%+v): %v", q, err)
+		return nil, false
+	}
+	return vals, true
+}
+
+func ids(products []bp.Product) string {
+	vals := make([]string, len(products))
+	for i, p := range products {
+		vals[i] = p.ID.String()
+	}
+	return strings.Join(vals, " ")
+}
+
+func set(hex ...string) string {
+	sort.Strings(hex)
+	return strings.Join(hex, " ")
+}
+
+func sorted(products []bp.Product) string {
+	vals := strings.Fields(ids(products))
+	return set(vals...)
+}
+
+func (c *checker) products() {
+	all, ok := c.search(bp.ProductQuery{Limit: 100})
+	if !ok {
+		return
+	}
+	if got, want := sorted(all), set(laciate, uht, maslo200, gouda, czekolada, kefir, laciateBox,
+		maka500, maka1, maka2, makaLuz); got != want {
+		c.errorf("Products: got %s, want %s", got, want)
+	}
+	for _, p := range all {
+		if p.ID.String() == maslo200 &&
+			(p.IDCategory.String() != maslo || p.Brand.Name != "Mlekovita" || p.PriceDescription.String != "200 g") {
+			c.errorf("Products: got %+v for Masło Extra", p)
+		}
+		if p.ID.String() == laciate && (p.Unit != bp.Litre || p.Price == nil || p.Price.Cmp(dec("3.49")) != 0 ||
+			p.UnitPrice == nil || p.UnitPrice.Cmp(dec("3.49")) != 0) {
+			c.errorf("Products: got %+v for Mleko Łaciate", p)
+		}
+	}
+
+	// the cheapest flour per kilogram comes first
+	if vals, ok := c.search(bp.ProductQuery{Phrase: "maka", Limit: 100, Sort: bp.SortUnitPrice}); ok {
+		var got []string
+		for _, p := range vals {
+			if p.UnitPrice != nil {
+				got = append(got, fmt.Sprintf("%s %s/%s", p.Name, p.UnitPrice.StringFixed(2), p.Unit))
+			}
+		}
+		want := "Mąka pszenna 1 kg 2.99/kg, Mąka pszenna 2 kg 3.00/kg, Mąka pszenna na wagę 3.39/kg, " +
+			"Mąka pszenna 500 g 3.98/kg"
+		if strings.Join(got, ", ") != want {
+			c.errorf("Products(maka) by unit price: got %s, want %s", strings.Join(got, ", "), want)
+		}
+	}
+
+	// pages are slices of the whole list
+	for offset := 0; offset <= len(all); offset += 2 {
+		page, ok := c.search(bp.ProductQuery{Limit: 2, Offset: offset})
+		if !ok {
+			return
+		}
+		end := offset + 2
+		if end > len(all) {
+			end = len(all)
+		}
+		if got, want := ids(page), ids(all[offset:end]); got != want {
+			c.errorf("Products offset %d: got %s, want %s", offset, got, want)
+		}
+	}
+
+	cases := []struct {
+		phrase   string
+		category string
+		want     string
+	}{
+		{"mleko", "", set(laciate, laciateBox, uht, kefir, maslo200)},
+		{"maslo", "", set(maslo200)},
+		{"ŁACIATE", "", set(laciate, laciateBox)},
+		{"gouda czekolada", "", set(gouda, czekolada)},
+		{"", nabial, set(laciate, laciateBox, uht, kefir, maslo200, gouda)},
+		{"", mleko, set(laciate, laciateBox, uht, kefir)},
+		{"", laciate, set(laciate, laciateBox)},
+		{"mle", slodycze, set(czekolada)},
+		{"mleko", slodycze, set()},
+	}
+	for _, tc := range cases {
+		q := bp.ProductQuery{Phrase: tc.phrase, Limit: 100}
+		if tc.category != "" {
+			cat := id(tc.category)
+			q.Category = &cat
+		}
+		vals, ok := c.search(q)
+		if ok && sorted(vals) != tc.want {
+			c.errorf("Products(%q, %s): got %s, want %s", tc.phrase, tc.category, sorted(vals), tc.want)
+		}
+	}
+
+	// name matches rank first
+	vals, ok := c.search(bp.ProductQuery{Phrase: "mleko", Limit: 100})
+	if ok && len(vals) == 5 {
+		if got, want := sorted(vals[:3]), set(laciate, laciateBox, uht); got != want {
+			c.errorf("Products(mleko): got %s first, want %s", got, want)
+		}
+	}
+
+	for _, phrase := range Hostile {
+		vals, ok := c.search(bp.ProductQuery{Phrase: phrase, Limit: 100})
+		if !ok {
+			continue
+		}
+		words, _ := bp.SearchWords(phrase)
+		same, ok := c.search(bp.ProductQuery{Phrase: strings.Join(words, " "), Limit: 100})
+		if ok && ids(vals) != ids(same) {
+			c.errorf("Products(%q): got %s, want %s", phrase, ids(vals), ids(same))
+		}
+	}
+	if vals, ok := c.search(bp.ProductQuery{Limit: 100}); ok && len(vals) != len(all) {
+		c.errorf("Products: got %d products after hostile phrases, want %d", len(vals), len(all))
+	}
+}
+
+type basket struct {
+	products []bp.ShopRequestProduct
+	chains   []string
+	max      int
+	cost     string
+	location *bp.Location
+	distance float64
+	partial  bool
+	cards    []string
+}
+
+func (b basket) request() *bp.ShopRequest {
+	req := &bp.ShopRequest{
+		Products:    b.products,
+		Location:    b.location,
+		MaxDistance: b.distance,
+		Partial:     b.partial,
+	}
+	req.UserPreference.MaxStores = b.max
+	if b.cost != "" {
+		req.UserPreference.StoreCost = dec(b.cost)
+	}
+	for _, cs := range b.chains {
+		req.UserPreference.IDs = append(req.UserPreference.IDs, id(cs))
+	}
+	for _, cs := range b.cards {
+		req.UserPreference.LoyaltyCards = append(req.UserPreference.LoyaltyCards, id(cs))
+	}
+	return req
+}
+
+func item(hex string, count int) bp.ShopRequestProduct {
+	return bp.ShopRequestProduct{ID: id(hex), Count: decimal.New(int64(count), 0)}
+}
+
+// unavailable formats the products as id: chain price, ...
+func unavailable(vals []bp.UnavailableProduct) string {
+	var lines []string
+	for _, u := range vals {
+		var offers []string
+		for _, o := range u.Offers {
+			offers = append(offers, o.ChainStoreName+" "+o.Price.StringFixed(2))
+		}
+		lines = append(lines, u.ID.String()+": "+strings.Join(offers, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *checker) shop() {
+	all := []string{biedronka, lidl, auchan}
+	big := []bp.ShopRequestProduct{item(laciate, 2), item(uht, 1), item(maslo200, 1), item(gouda, 1)}
+	warsaw := &bp.Location{Lat: dec("52.2297"), Lng: dec("21.0122")}
+
+	cases := []struct {
+		name   string
+		basket basket
+		total  string
+		stores string
+	}{
+		{"one store", basket{products: []bp.ShopRequestProduct{item(laciate, 2), item(maslo200, 1)}, chains: all, max: 1},
+			"13.57", set(lidl)},
+		{"two stores", basket{products: big, chains: all, max: 2}, "21.35", set(lidl, auchan)},
+		{"single store basket", basket{products: big, chains: all, max: 1}, "24.25", set(auchan)},
+		{"store cost", basket{products: big, chains: all, max: 2, cost: "3"}, "24.25", set(auchan)},
+		{"category", basket{products: []bp.ShopRequestProduct{item(mleko, 1)}, chains: all, max: 1},
+			"2.49", set(biedronka)},
+		{"nearby", basket{products: []bp.ShopRequestProduct{item(laciate, 2), item(maslo200, 1)}, chains: all, max: 2,
+			location: warsaw, distance: 10}, "13.57", set(lidl)},
+		{"not in prefered stores", basket{products: []bp.ShopRequestProduct{item(kefir, 1)}, chains: []string{lidl}, max: 1},
+			"", ""},
+		{"unknown product", basket{products: []bp.ShopRequestProduct{{ID: bp.RandID(), Count: dec("1")}}, chains: all, max: 1},
+			"", ""},
+		{"too far", basket{products: []bp.ShopRequestProduct{item(gouda, 1)}, chains: []string{auchan}, max: 1,
+			location: warsaw, distance: 10}, "", ""},
+	}
+	for _, tc := range cases {
+		req := tc.basket.request()
+		if err := req.Valid(); err != nil {
+			c.errorf("Shop %s: %v", tc.name, err)
+			continue
+		}
+		shop, err := c.s.Shop(req)
+		if err != nil {
+			c.errorf("Shop %s: %v", tc.name, err)
+			continue
+		}
+		if tc.total == "" {
+			if shop.Error == "" {
+				c.errorf("Shop %s: got %+v, want an error", tc.name, shop)
+			}
+			continue
+		}
+		var stores []string
+		for _, st := range shop.Stores {
+			stores = append(stores, st.ID.String())
+		}
+		if shop.Error != "" || shop.PriceTotal.Cmp(dec(tc.total)) != 0 || set(stores...) != tc.stores {
+			c.errorf("Shop %s: got %s in %s (%s), want %s in %s",
+				tc.name, shop.PriceTotal, set(stores...), shop.Error, tc.total, tc.stores)
+		}
+	}
+
+	// the cheaper variant is bought for the requested product
+	req := basket{products: []bp.ShopRequestProduct{item(laciate, 2)}, chains: []string{lidl}, max: 1}.request()
+	shop, err := c.s.Shop(req)
+	if err != nil {
+		c.errorf("Shop variant: %v", err)
+	} else if len(shop.Stores) != 1 || len(shop.Stores[0].Products) != 1 {
+		c.errorf("Shop variant: got %+v", shop)
+	} else if p := shop.Stores[0].Products[0]; p.ID.String() != laciate || p.Product != "Mleko Łaciate 2% karton" ||
+		p.Count.Cmp(dec("2")) != 0 || p.Price.Cmp(dec("6.58")) != 0 {
+		c.errorf("Shop variant: got %+v", p)
+	}
+
+	// the nearest store of the chain is attached
+	req = basket{products: []bp.ShopRequestProduct{item(maslo200, 1)}, chains: []string{lidl}, max: 1,
+		location: warsaw}.request()
+	shop, err = c.s.Shop(req)
+	if err != nil {
+		c.errorf("Shop nearest: %v", err)
+	} else if len(shop.Stores) != 1 || shop.Stores[0].Store == nil ||
+		shop.Stores[0].Store.ID.String() != lidlPowisle || !shop.Stores[0].Distance.Valid {
+		c.errorf("Shop nearest: got %+v", shop)
+	}
+
+	// products missing from the prefered stores are reported with the
+	// chains selling them, a partial shop buys the rest
+	want := kefir + ": Biedronka 4.98"
+	b := basket{products: []bp.ShopRequestProduct{item(kefir, 2), item(maslo200, 1)}, chains: []string{lidl}, max: 1}
+	shop, err = c.s.Shop(b.request())
+	if err != nil {
+		c.errorf("Shop unavailable: %v", err)
+	} else if shop.Code != bp.ShopUnavailable || len(shop.Stores) != 0 || unavailable(shop.Unavailable) != want {
+		c.errorf("Shop unavailable: got %+v, want %s and %s", shop, bp.ShopUnavailable, want)
+	}
+	b.partial = true
+	shop, err = c.s.Shop(b.request())
+	if err != nil {
+		c.errorf("Shop partial: %v", err)
+	} else if shop.Error != "" || shop.PriceTotal.Cmp(dec("6.99")) != 0 || unavailable(shop.Unavailable) != want {
+		c.errorf("Shop partial: got %s (%s) without %s, want 6.99 without %s",
+			shop.PriceTotal, shop.Error, unavailable(shop.Unavailable), want)
+	}
+
+	// products sold by the prefered chains, but by no max_stores of them
+	b = basket{products: []bp.ShopRequestProduct{item(kefir, 1), item(gouda, 1)}, chains: all, max: 1}
+	shop, err = c.s.Shop(b.request())
+	if err != nil {
+		c.errorf("Shop max stores: %v", err)
+	} else if shop.Code != bp.ShopMaxStores || len(shop.Stores) != 0 || len(shop.Unavailable) != 0 {
+		c.errorf("Shop max stores: got %+v, want %s", shop, bp.ShopMaxStores)
+	}
+
+	// a quantity is filled from the cheapest packs, multi-buys of the
+	// packs count for every pack bought
+	flour := []bp.ShopRequestProduct{{ID: id(maka), Quantity: dec("2.5"), Unit: bp.Kilogram}}
+	quantities := []struct {
+		name  string
+		cards []string
+		total string
+		want  string
+	}{
+		{"quantity", nil, "7.98", "Biedronka 1×0.5 kg, Biedronka 1×2 kg"},
+		{"quantity multi-buy", []string{biedronka}, "5.97", "Biedronka 5×0.5 kg"},
+	}
+	for _, tc := range quantities {
+		shop, err := c.s.Shop(basket{products: flour, chains: []string{biedronka, lidl}, max: 1, cards: tc.cards}.request())
+		if err != nil {
+			c.errorf("Shop %s: %v", tc.name, err)
+			continue
+		}
+		var got []string
+		for _, st := range shop.Stores {
+			for _, p := range st.Products {
+				got = append(got, fmt.Sprintf("%s %s×%s %s", st.ChainStoreName, p.Count, p.Quantity, p.Unit))
+			}
+		}
+		sort.Strings(got)
+		if shop.Error != "" || shop.PriceTotal.Cmp(dec(tc.total)) != 0 || strings.Join(got, ", ") != tc.want {
+			c.errorf("Shop %s: got %s (%s) of %s, want %s of %s",
+				tc.name, shop.PriceTotal, shop.Error, strings.Join(got, ", "), tc.total, tc.want)
+		}
+	}
+
+	// products sold by weight are bought in fractions, rounded to grosz,
+	// the others in whole packs
+	weighed := []struct {
+		name    string
+		product bp.ShopRequestProduct
+		total   string
+		field   string
+	}{
+		{"fraction", bp.ShopRequestProduct{ID: id(makaLuz), Count: dec("0.75"), Unit: bp.Kilogram}, "2.54", ""},
+		{"quantity", bp.ShopRequestProduct{ID: id(maka), Quantity: dec("1.2"), Unit: bp.Kilogram}, "4.07", ""},
+		{"fraction of a pack", bp.ShopRequestProduct{ID: id(maka1), Count: dec("0.5")}, "", "products[0].count"},
+		{"unit", bp.ShopRequestProduct{ID: id(makaLuz), Count: dec("1"), Unit: bp.Litre}, "", "products[0].unit"},
+	}
+	for _, tc := range weighed {
+		req := basket{products: []bp.ShopRequestProduct{tc.product}, chains: []string{biedronka}, max: 1}.request()
+		if err := req.Valid(); err != nil {
+			c.errorf("Shop %s: %v", tc.name, err)
+			continue
+		}
+		shop, err := c.s.Shop(req)
+		var fields bp.ValidationError
+		switch {
+		case tc.field != "":
+			if !errors.As(err, &fields) || len(fields) != 1 || fields[0].Field != tc.field {
+				c.errorf("Shop %s: got %+v (%v), want an error on %s", tc.name, shop, err, tc.field)
+			}
+		case err != nil:
+			c.errorf("Shop %s: %v", tc.name, err)
+		case shop.Error != "" || shop.PriceTotal.Cmp(dec(tc.total)) != 0:
+			c.errorf("Shop %s: got %s (%s), want %s", tc.name, shop.PriceTotal, shop.Error, tc.total)
+		}
+	}
+
+	// a similar product of the category is bought in place of one missing
+	// or dearer, kefir differing in volume is not
+	subs := []struct {
+		name    string
+		basket  basket
+		total   string
+		product string
+		saving  string
+	}{
+		{"missing", basket{products: []bp.ShopRequestProduct{{ID: id(uht), Count: dec("1"), AllowSubstitutes: true}},
+			chains: []string{lidl}, max: 1}, "3.29", "Mleko Łaciate 2% karton", ""},
+		{"cheaper", basket{products: []bp.ShopRequestProduct{{ID: id(laciate), Count: dec("2"), AllowSubstitutes: true}},
+			chains: []string{biedronka, auchan}, max: 1}, "5.58", "Mleko UHT 3,2%", "1.40"},
+		{"not similar", basket{products: []bp.ShopRequestProduct{{ID: id(kefir), Count: dec("1"), AllowSubstitutes: true}},
+			chains: []string{biedronka}, max: 1}, "2.49", "", ""},
+	}
+	for _, tc := range subs {
+		shop, err := c.s.Shop(tc.basket.request())
+		if err != nil {
+			c.errorf("Shop substitute %s: %v", tc.name, err)
+			continue
+		}
+		var got, saving string
+		for _, sub := range shop.Substitutions {
+			got = sub.Product
+			if sub.Saving != nil {
+				saving = sub.Saving.StringFixed(2)
+			}
+		}
+		if shop.Error != "" || shop.PriceTotal.Cmp(dec(tc.total)) != 0 || len(shop.Substitutions) > 1 ||
+			got != tc.product || saving != tc.saving {
+			c.errorf("Shop substitute %s: got %s (%s) with %q saving %q, want %s with %q saving %q",
+				tc.name, shop.PriceTotal, shop.Error, got, saving, tc.total, tc.product, tc.saving)
+		}
+	}
+
+	// prices narrowed to a store, a district or a region apply to the
+	// nearest store of the chain, the most specific first
+	krakow := &bp.Location{Lat: dec("50.0600"), Lng: dec("19.9400")}
+	scopes := []struct {
+		name   string
+		basket basket
+		total  string
+	}{
+		{"store", basket{products: []bp.ShopRequestProduct{item(maslo200, 1)}, chains: []string{lidl}, max: 1,
+			location: krakow}, "5.99"},
+		{"chain", basket{products: []bp.ShopRequestProduct{item(maslo200, 1)}, chains: []string{lidl}, max: 1}, "6.99"},
+		{"district", basket{products: []bp.ShopRequestProduct{item(uht, 1)}, chains: []string{biedronka}, max: 1,
+			location: warsaw}, "2.59"},
+		{"region", basket{products: []bp.ShopRequestProduct{item(gouda, 1)}, chains: []string{auchan}, max: 1,
+			location: krakow}, "4.49"},
+		{"other region", basket{products: []bp.ShopRequestProduct{item(maslo200, 1)}, chains: []string{lidl}, max: 1,
+			location: warsaw}, "6.99"},
+	}
+	for _, tc := range scopes {
+		shop, err := c.s.Shop(tc.basket.request())
+		if err != nil {
+			c.errorf("Shop scope %s: %v", tc.name, err)
+		} else if shop.Error != "" || shop.PriceTotal.Cmp(dec(tc.total)) != 0 {
+			c.errorf("Shop scope %s: got %s (%s), want %s", tc.name, shop.PriceTotal, shop.Error, tc.total)
+		}
+	}
+
+	// promotions valid now lower the price of the packs they apply to,
+	// loyalty card ones for holders of the card only
+	promos := []struct {
+		name     string
+		basket   basket
+		total    string
+		chain    string
+		kind     bp.PromotionKind
+		discount string
+	}{
+		{"too few", basket{products: []bp.ShopRequestProduct{item(czekolada, 2)}, chains: []string{biedronka, lidl}, max: 1},
+			"8.58", lidl, "", "0"},
+		{"nth discount", basket{products: []bp.ShopRequestProduct{item(czekolada, 3)}, chains: []string{biedronka, lidl}, max: 1},
+			"10.73", lidl, bp.PromotionNthDiscount, "2.14"},
+		{"loyalty card", basket{products: []bp.ShopRequestProduct{item(czekolada, 2)}, chains: []string{biedronka, lidl}, max: 1,
+			cards: []string{biedronka}}, "4.59", biedronka, bp.PromotionMultiBuy, "4.59"},
+		{"odd multi-buy", basket{products: []bp.ShopRequestProduct{item(czekolada, 3)}, chains: []string{biedronka}, max: 1,
+			cards: []string{biedronka}}, "9.18", biedronka, bp.PromotionMultiBuy, "4.59"},
+	}
+	for _, tc := range promos {
+		shop, err := c.s.Shop(tc.basket.request())
+		if err != nil {
+			c.errorf("Shop promotion %s: %v", tc.name, err)
+			continue
+		}
+		var (
+			chain, discount string
+			kind            bp.PromotionKind
+		)
+		for _, st := range shop.Stores {
+			chain, discount = st.ID.String(), st.Discount.String()
+			for _, p := range st.Products {
+				if p.Promotion != nil {
+					kind = p.Promotion.Kind
+				}
+			}
+		}
+		if shop.Error != "" || shop.PriceTotal.Cmp(dec(tc.total)) != 0 || len(shop.Stores) != 1 ||
+			chain != tc.chain || kind != tc.kind || discount != tc.discount {
+			c.errorf("Shop promotion %s: got %s (%s) in %s by %q saving %s, want %s in %s by %q saving %s",
+				tc.name, shop.PriceTotal, shop.Error, chain, kind, discount, tc.total, tc.chain, tc.kind, tc.discount)
+		}
+	}
+}
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// points formats the history as chain: period min max avg observations.
+func points(vals []bp.PriceHistory) string {
+	var lines []string
+	for _, h := range vals {
+		for _, p := range h.Prices {
+			lines = append(lines, fmt.Sprintf("%s: %s %s %s %s %d", h.ChainStore, p.Period.UTC().Format("2006-01-02"),
+				p.Min.StringFixed(2), p.Max.StringFixed(2), p.Avg.StringFixed(2), p.Observations))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *checker) history() {
+	cases := []struct {
+		product  string
+		from, to string
+		step     bp.Aggregation
+		want     string
+	}{
+		{laciate, "2024-03-01", "2024-04-01", bp.Daily, strings.Join([]string{
+			"Auchan: 2024-03-06 3.99 3.99 3.99 1",
+			"Biedronka: 2024-03-04 3.69 3.79 3.74 2",
+			"Biedronka: 2024-03-05 3.49 3.49 3.49 1",
+			"Lidl: 2024-03-06 3.59 3.59 3.59 1",
+		}, "\n")},
+		{laciate, "2024-03-01", "2024-04-01", bp.Weekly, strings.Join([]string{
+			"Auchan: 2024-03-04 3.99 3.99 3.99 1",
+			"Biedronka: 2024-03-04 3.49 3.79 3.66 3",
+			"Lidl: 2024-03-04 3.59 3.59 3.59 1",
+		}, "\n")},
+		{laciate, "2024-03-05", "2024-03-06", bp.Daily, "Biedronka: 2024-03-05 3.49 3.49 3.49 1"},
+		{laciateBox, "2024-03-01", "2024-04-01", bp.Daily, "Lidl: 2024-03-06 3.29 3.29 3.29 1"},
+		{gouda, "2024-04-01", "2024-05-01", bp.Daily, ""},
+		// overrides of the Lidl price are not part of its history
+		{maslo200, "2024-03-01", "2024-04-01", bp.Daily, strings.Join([]string{
+			"Auchan: 2024-03-06 8.49 8.49 8.49 1",
+			"Biedronka: 2024-03-06 7.99 7.99 7.99 1",
+			"Lidl: 2024-03-06 6.99 6.99 6.99 1",
+		}, "\n")},
+	}
+	for _, tc := range cases {
+		vals, err := c.s.PriceHistory(id(tc.product), date(tc.from), date(tc.to), tc.step)
+		if err != nil {
+			c.errorf("PriceHistory(%s, %s): %v", tc.product, tc.step, err)
+			continue
+		}
+		if got := points(vals); got != tc.want {
+			c.errorf("PriceHistory(%s, %s, %s, %s): got\n%s\nwant\n%s",
+				tc.product, tc.from, tc.to, tc.step, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package bp
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Event is a change of a row of the catalog or of a price, the ids of the
+// row are set. Price events carry the price and when it was observed,
+// override events also the Region or District they narrow the price to.
+type Event struct {
+	Table        string `json:"table"`
+	Op           string `json:"op"`
+	IDProduct    ID     `json:"id_product"`
+	IDBrand      ID     `json:"id_brand"`
+	IDChainStore ID     `json:"id_chain_store"`
+	IDStore      ID     `json:"id_store"`
+	Region       string `json:"region,omitempty"`
+	District     string `json:"district,omitempty"`
+
+	UnitPrice *decimal.Decimal `json:"unit_price,omitempty"`
+	Observed  *time.Time       `json:"observed_at,omitempty"`
+}
+
+const (
+	// TablePrice holds the current prices and TablePriceOverride their
+	// overrides in narrower scopes, the other tables the catalog.
+	TablePrice         = "price"
+	TablePriceOverride = "price_override"
+	// EventResync is the Op of events reporting some changes were missed,
+	// any row may have changed.
+	EventResync = "resync"
+)
+
+// Catalog reports whether the catalog may have changed.
+func (e Event) Catalog() bool {
+	return e.Table != TablePrice && e.Table != TablePriceOverride
+}
+
+// Price reports whether a price may have changed.
+func (e Event) Price() bool {
+	return e.Table == TablePrice || e.Table == TablePriceOverride || e.Op == EventResync
+}
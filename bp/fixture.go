@@ -0,0 +1,52 @@
+package bp
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"os"
+)
+
+//go:embed fixture.json
+var demo []byte
+
+// Fixture is a catalog with its prices, served by the in-memory service
+// and seeded into development databases. Categories and products refer to
+// their parent by id, a product may also be the parent of its variants.
+type Fixture struct {
+	Categories  []Category   `json:"categories"`
+	Brands      []Brand      `json:"brands"`
+	Products    []Product    `json:"products"`
+	Chainstores []Chainstore `json:"chain_stores"`
+	Stores      []Store      `json:"stores"`
+	Prices      []PriceRow   `json:"prices"`
+	Promotions  []Promotion  `json:"promotions"`
+}
+
+func ReadFixture(r io.Reader) (*Fixture, error) {
+	var f Fixture
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func LoadFixture(path string) (*Fixture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadFixture(file)
+}
+
+// DemoFixture returns the demo catalog, seeded when no fixture is given and
+// checked by bptest.TestService.
+func DemoFixture() *Fixture {
+	f, err := ReadFixture(bytes.NewReader(demo))
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
@@ -0,0 +1,42 @@
+package bp
+
+import (
+	"math"
+
+	"github.com/shopspring/decimal"
+)
+
+// earthRadius is the mean radius of the Earth in kilometres.
+const earthRadius = 6371.0
+
+type Location struct {
+	Lat decimal.Decimal `json:"latitude"`
+	Lng decimal.Decimal `json:"longitude"`
+}
+
+func (l *Location) Valid() error {
+	lat, _ := l.Lat.Float64()
+	lng, _ := l.Lng.Float64()
+	var errs ValidationError
+	if lat < -90 || lat > 90 {
+		errs.add("latitude", "must be between -90 and 90")
+	}
+	if lng < -180 || lng > 180 {
+		errs.add("longitude", "must be between -180 and 180")
+	}
+	return errs.err()
+}
+
+// Distance returns the haversine distance in kilometres between l and o.
+func (l Location) Distance(o Location) float64 {
+	rad := func(d decimal.Decimal) float64 {
+		f, _ := d.Float64()
+		return f * math.Pi / 180
+	}
+	lat1, lat2 := rad(l.Lat), rad(o.Lat)
+	dlat, dlng := lat2-lat1, rad(o.Lng)-rad(l.Lng)
+
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dlng/2)*math.Sin(dlng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,41 @@
+package bp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Aggregation is the length of the period price observations are grouped by.
+type Aggregation string
+
+const (
+	Daily  Aggregation = "day"
+	Weekly Aggregation = "week"
+)
+
+func (a Aggregation) Valid() error {
+	switch a {
+	case Daily, Weekly:
+		return nil
+	}
+	return errors.New("aggregation must be one of: day, week")
+}
+
+// PricePoint summarises the prices observed during one period.
+type PricePoint struct {
+	Period       time.Time       `json:"period"`
+	Min          decimal.Decimal `json:"min_price"`
+	Max          decimal.Decimal `json:"max_price"`
+	Avg          decimal.Decimal `json:"avg_price"`
+	Observations int             `json:"observations"`
+}
+
+// PriceHistory is the chain wide price of a product in a chain store over
+// time, overrides narrowed to some of its stores are left out.
+type PriceHistory struct {
+	IDChainStore ID           `json:"id_chain_store"`
+	ChainStore   string       `json:"chain_store_name"`
+	Prices       []PricePoint `json:"prices"`
+}
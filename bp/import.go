@@ -0,0 +1,242 @@
+package bp
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PriceScope narrows a price of a chain store to its stores of a region,
+// of a district or to a single store, it applies to every store of the
+// chain when empty.
+type PriceScope struct {
+	IDStore  *ID    `json:"id_store,omitempty"`
+	Region   string `json:"region,omitempty"`
+	District string `json:"district,omitempty"`
+}
+
+func (s *PriceScope) Valid() error {
+	if s.IDStore != nil && (s.Region != "" || s.District != "") {
+		return errors.New("region and district can not be set along with a store")
+	}
+	return nil
+}
+
+// Empty reports whether the scope is the whole chain store.
+func (s *PriceScope) Empty() bool {
+	return s.IDStore == nil && s.Region == "" && s.District == ""
+}
+
+// Specificity ranks how closely the scope matches st, 3 for the store
+// itself, 2 for its district, 1 for its region and 0 for the chain, -1
+// when it does not apply. Only empty scopes apply to a nil store.
+func (s *PriceScope) Specificity(st *Store) int {
+	switch {
+	case s.Empty():
+		return 0
+	case st == nil:
+		return -1
+	case s.IDStore != nil:
+		if s.IDStore.String() == st.ID.String() {
+			return 3
+		}
+	case s.District != "":
+		if s.District == st.District.String && (s.Region == "" || s.Region == st.Region.String) {
+			return 2
+		}
+	case s.Region == st.Region.String:
+		return 1
+	}
+	return -1
+}
+
+// PriceRow is a price of a product observed in a chain store, or in the
+// stores of its scope.
+type PriceRow struct {
+	Row int `json:"-"`
+
+	IDChainStore     ID              `json:"id_chain_store"`
+	IDProduct        ID              `json:"id_product"`
+	IDBrand          ID              `json:"id_brand"`
+	Price            decimal.Decimal `json:"price"`
+	PriceDescription string          `json:"price_description"`
+	Observed         time.Time       `json:"observed_at"`
+
+	PriceScope
+}
+
+func (r *PriceRow) Valid() error {
+	if r.IDChainStore.Null() {
+		return errors.New("chain store must be set")
+	}
+	if r.IDProduct.Null() {
+		return errors.New("product must be set")
+	}
+	if r.IDBrand.Null() {
+		return errors.New("brand must be set")
+	}
+	return r.PriceScope.Valid()
+}
+
+// RowError reports why a row of an import was rejected.
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type ImportReport struct {
+	Rows     int        `json:"rows"`
+	Imported int        `json:"imported"`
+	Errors   []RowError `json:"errors"`
+}
+
+// AddErrors adds rows rejected before the import to the report.
+func (r *ImportReport) AddErrors(bad []RowError) {
+	r.Rows += len(bad)
+	r.Errors = append(r.Errors, bad...)
+	sort.Slice(r.Errors, func(i, j int) bool { return r.Errors[i].Row < r.Errors[j].Row })
+}
+
+// CSVColumns are the columns a CSV price feed must have in its header.
+var CSVColumns = []string{"id_chain_store", "id_product", "id_brand",
+	"price", "price_description", "observed_at"}
+
+// CSVScopeColumns are the optional columns of a CSV price feed narrowing a
+// price to a store, a region or a district.
+var CSVScopeColumns = []string{"id_store", "region", "district"}
+
+// ReadPriceCSV reads a CSV price feed with a header row naming CSVColumns
+// and any of CSVScopeColumns in any order. Rows are numbered from 1, not
+// counting the header.
+func ReadPriceCSV(r io.Reader) ([]PriceRow, []RowError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.TrimSpace(name)] = i
+	}
+	for _, name := range CSVColumns {
+		if _, ok := col[name]; !ok {
+			return nil, nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	var (
+		rows []PriceRow
+		bad  []RowError
+	)
+	for n := 1; ; n++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if _, ok := err.(*csv.ParseError); ok {
+			bad = append(bad, RowError{Row: n, Error: err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		field := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return rec[i]
+			}
+			return ""
+		}
+		row, err := parseCSVRow(field)
+		if err != nil {
+			bad = append(bad, RowError{Row: n, Error: err.Error()})
+			continue
+		}
+		row.Row = n
+		rows = append(rows, row)
+	}
+	return rows, bad, nil
+}
+
+func parseCSVRow(field func(string) string) (PriceRow, error) {
+	var (
+		row PriceRow
+		err error
+		ids = map[string]*ID{
+			"id_chain_store": &row.IDChainStore,
+			"id_product":     &row.IDProduct,
+			"id_brand":       &row.IDBrand,
+		}
+	)
+	for name, id := range ids {
+		v, err := NewID(field(name))
+		if err != nil {
+			return row, fmt.Errorf("%s: %v", name, err)
+		}
+		*id = *v
+	}
+	if row.Price, err = decimal.NewFromString(field("price")); err != nil {
+		return row, fmt.Errorf("price: %v", err)
+	}
+	row.PriceDescription = field("price_description")
+	if v := field("observed_at"); v != "" {
+		if row.Observed, err = time.Parse(time.RFC3339, v); err != nil {
+			return row, fmt.Errorf("observed_at: %v", err)
+		}
+	}
+	if v := field("id_store"); v != "" {
+		if row.IDStore, err = NewID(v); err != nil {
+			return row, fmt.Errorf("id_store: %v", err)
+		}
+	}
+	row.Region = field("region")
+	row.District = field("district")
+	return row, row.PriceScope.Valid()
+}
+
+// ReadPriceNDJSON reads one JSON encoded PriceRow per line, blank lines are
+// skipped. Rows are numbered by line.
+func ReadPriceNDJSON(r io.Reader) ([]PriceRow, []RowError, error) {
+	var (
+		rows []PriceRow
+		bad  []RowError
+		sc   = bufio.NewScanner(r)
+	)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var row PriceRow
+		err := json.Unmarshal([]byte(line), &row)
+		if err == nil {
+			err = row.Valid()
+		}
+		if err != nil {
+			bad = append(bad, RowError{Row: n, Error: err.Error()})
+			continue
+		}
+		row.Row = n
+		rows = append(rows, row)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 && len(bad) == 0 {
+		return nil, nil, errors.New("no rows")
+	}
+	return rows, bad, nil
+}
@@ -1,5 +1,7 @@
 package bp
 
+import "time"
+
 // Client creates a connection to the services.
 type Client interface {
 	Service() Service
@@ -9,6 +11,93 @@ type Service interface {
 	Categories() ([]Category, error)
 	Chainstores() ([]Chainstore, error)
 	Stores() ([]Store, error)
-	Products(category *ID, phrase string) ([]Product, error)
+	Products(q ProductQuery) ([]Product, error)
 	Shop(r *ShopRequest) (Shop, error)
+	PriceHistory(product ID, from, to time.Time, step Aggregation) ([]PriceHistory, error)
+}
+
+// EventSource delivers the changes of the catalog and of prices.
+type EventSource interface {
+	Subscribe() <-chan Event
+	Unsubscribe(events <-chan Event)
+}
+
+type AlertService interface {
+	Alerts(subscriber string) ([]Alert, error)
+	Alert(id ID) (Alert, error)
+	CreateAlert(a *Alert) error
+	UpdateAlert(a *Alert) error
+	DeleteAlert(id ID) error
+
+	// EvaluateAlerts moves the alerts whose target price has been reached
+	// to the outbox and returns how many were triggered.
+	EvaluateAlerts() (int, error)
+	// PendingAlerts returns at most n triggered alerts not yet delivered
+	// and not handed to another caller recently, so concurrent callers
+	// deliver every alert once unless its delivery fails.
+	PendingAlerts(n int) ([]TriggeredAlert, error)
+	MarkDelivered(id int64) error
+}
+
+type ImportService interface {
+	// ImportPrices stores the rows matching the catalog in a single
+	// transaction and reports the rejected ones.
+	ImportPrices(rows []PriceRow, source string) (ImportReport, error)
+}
+
+// AdminService edits the catalog. Categories are products without a price
+// description, they form the tree products are placed in.
+type AdminService interface {
+	CreateCategory(c *Category) error
+	UpdateCategory(c *Category) error
+	DeleteCategory(id ID) error
+
+	CreateProduct(p *Product) error
+	UpdateProduct(p *Product) error
+	DeleteProduct(id ID) error
+
+	CreateBrand(b *Brand) error
+	UpdateBrand(b *Brand) error
+	DeleteBrand(id ID) error
+
+	CreateChainstore(c *Chainstore) error
+	UpdateChainstore(c *Chainstore) error
+	DeleteChainstore(id ID) error
+
+	CreateStore(s *Store) error
+	UpdateStore(s *Store) error
+	DeleteStore(id ID) error
+
+	CreatePromotion(p *Promotion) error
+	UpdatePromotion(p *Promotion) error
+	DeletePromotion(id ID) error
+}
+
+type KeyService interface {
+	Keys() ([]APIKey, error)
+	// CreateKey stores k and sets its ID and Secret.
+	CreateKey(k *APIKey) error
+	// RotateKey replaces the secret of the key, the old one stops working.
+	RotateKey(id ID) (APIKey, error)
+	RevokeKey(id ID) error
+	// Authenticate returns the key with the secret, or ErrNotFound.
+	Authenticate(secret string) (APIKey, error)
+}
+
+type UserService interface {
+	Register(c Credentials) (Session, error)
+	// RegisterDevice creates an anonymous account for a device.
+	RegisterDevice() (Session, error)
+	Login(c Credentials) (Session, error)
+	// Authenticate returns the user of the session token, or ErrUnauthorized
+	// once it expired or ended.
+	Authenticate(token string) (User, error)
+	// Logout ends the session of the token.
+	Logout(token string) error
+
+	Lists(user ID) ([]ShoppingList, error)
+	List(user, id ID) (ShoppingList, error)
+	CreateList(user ID, l *ShoppingList) error
+	UpdateList(user ID, l *ShoppingList) error
+	DeleteList(user, id ID) error
 }
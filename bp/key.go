@@ -0,0 +1,59 @@
+package bp
+
+import (
+	"errors"
+	"time"
+)
+
+// Scope is a set of routes an API key gives access to.
+type Scope string
+
+const (
+	ScopeRead   Scope = "read"
+	ScopeImport Scope = "import"
+	ScopeAlerts Scope = "alerts"
+	ScopeAdmin  Scope = "admin"
+)
+
+// APIKey authorizes requests to the routes of its scopes.
+type APIKey struct {
+	ID      ID         `json:"id_key"`
+	Name    string     `json:"name"`
+	Scopes  []Scope    `json:"scopes"`
+	Created time.Time  `json:"created_at"`
+	Revoked *time.Time `json:"revoked_at,omitempty"`
+
+	// Secret is only known when the key is created or rotated, only its
+	// hash is stored.
+	Secret string `json:"secret,omitempty"`
+}
+
+func (k *APIKey) Valid() error {
+	if k.Name == "" {
+		return errors.New("name must be set")
+	}
+	if len(k.Scopes) == 0 {
+		return errors.New("at least one scope must be set")
+	}
+	for _, s := range k.Scopes {
+		switch s {
+		case ScopeRead, ScopeImport, ScopeAlerts, ScopeAdmin:
+		default:
+			return errors.New("scope must be one of: read, import, alerts, admin")
+		}
+	}
+	return nil
+}
+
+// Allows reports whether the key grants scope s, admin grants every scope.
+func (k *APIKey) Allows(s Scope) bool {
+	if k.Revoked != nil {
+		return false
+	}
+	for _, ks := range k.Scopes {
+		if ks == s || ks == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
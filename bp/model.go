@@ -1,14 +1,15 @@
 package bp
 
 import (
-	"errors"
+	"encoding/json"
+	"fmt"
 
 	"github.com/shopspring/decimal"
 )
 
 type Category struct {
 	ID            ID         `json:"id_category"`
-	IDParent      ID         `json:"-"`
+	IDParent      ID         `json:"id_parent"`
 	Name          string     `json:"name"`
 	Subcategories []Category `json:"subcategories,omitempty"`
 }
@@ -19,19 +20,26 @@ type Chainstore struct {
 }
 
 type Store struct {
-	ID       ID              `json:"id_store"`
-	CSName   JsonNullString  `json:"chain_store_name"`
-	Name     JsonNullString  `json:"store_name"`
-	City     JsonNullString  `json:"city"`
-	Street   JsonNullString  `json:"street_and_nr"`
-	District JsonNullString  `json:"district"`
-	Region   JsonNullString  `json:"region"`
-	Lat      decimal.Decimal `json:"latitude"`
-	Lng      decimal.Decimal `json:"longitude"`
+	ID           ID              `json:"id_store"`
+	IDChainStore ID              `json:"id_chain_store"`
+	CSName       JsonNullString  `json:"chain_store_name"`
+	Name         JsonNullString  `json:"store_name"`
+	City         JsonNullString  `json:"city"`
+	Street       JsonNullString  `json:"street_and_nr"`
+	District     JsonNullString  `json:"district"`
+	Region       JsonNullString  `json:"region"`
+	Lat          decimal.Decimal `json:"latitude"`
+	Lng          decimal.Decimal `json:"longitude"`
+}
+
+// Distance returns the distance in kilometres from the store to l.
+func (s *Store) Distance(l Location) float64 {
+	return l.Distance(Location{Lat: s.Lat, Lng: s.Lng})
 }
 
 type Product struct {
 	ID                 ID             `json:"id_product"`
+	IDCategory         ID             `json:"id_category"`
 	Name               string         `json:"name"`
 	Weight             JsonNullInt64  `json:"weigth"`
 	Volume             JsonNullInt64  `json:"volume"`
@@ -39,7 +47,43 @@ type Product struct {
 	DecimalPossibility JsonNullBool   `json:"decimal_possibility"`
 	Brand              Brand          `json:"brand"`
 
-	Rank int `json:"-"`
+	// Price is the lowest current price of the product, UnitPrice the
+	// price of one Unit of it, both null when it is not sold.
+	Unit      Unit             `json:"unit"`
+	Price     *decimal.Decimal `json:"price"`
+	UnitPrice *decimal.Decimal `json:"unit_price"`
+
+	Rank float64 `json:"-"`
+}
+
+// Similar reports whether o is sold by about the same weight or volume as
+// p, within a tenth, so it may be bought in place of p.
+func (p *Product) Similar(o *Product) bool {
+	near := func(a, b JsonNullInt64) bool {
+		d := a.Int64 - b.Int64
+		if d < 0 {
+			d = -d
+		}
+		return a.Valid && b.Valid && a.Int64 > 0 && d*10 <= a.Int64
+	}
+	return near(p.Weight, o.Weight) || near(p.Volume, o.Volume)
+}
+
+// Orders of the products, by rank of the phrase or by unit price, the
+// products not sold last.
+const (
+	SortRank      = "rank"
+	SortUnitPrice = "unit_price"
+)
+
+// ProductQuery selects products of a category matching a phrase, a page
+// of Limit products starting at Offset ordered by Sort.
+type ProductQuery struct {
+	Category *ID
+	Phrase   string
+	Limit    int
+	Offset   int
+	Sort     string
 }
 
 type Brand struct {
@@ -48,14 +92,75 @@ type Brand struct {
 	// IDChainstore ID     `json:"id_chain_store"`
 }
 
+// maxCountScale is the number of decimal places of a count, grams of a
+// product sold by the kilogram.
+const maxCountScale = 3
+
 type ShopRequestProduct struct {
-	ID    ID  `json:"id_product"`
-	Count int `json:"count"`
+	ID ID `json:"id_product"`
+	// Count of packs to buy, fractional only for products sold by weight.
+	// Unit, when set, is the one the product must be sold in.
+	Count decimal.Decimal `json:"count"`
+	Unit  Unit            `json:"unit,omitempty"`
+
+	// Quantity of the product to buy in Unit instead of a count of packs,
+	// filled from the cheapest pack sizes.
+	Quantity decimal.Decimal `json:"quantity"`
+
+	// AllowSubstitutes lets a similar product of the same category, of
+	// any brand, be bought instead.
+	AllowSubstitutes bool `json:"allow_substitutes,omitempty"`
+}
+
+func (p *ShopRequestProduct) valid(errs *ValidationError, path string) {
+	if p.ID.Null() {
+		errs.add(path+".id_product", "must be set")
+	}
+	if p.Quantity.Cmp(decimal.Zero) == 0 {
+		if p.Count.Cmp(decimal.Zero) <= 0 {
+			errs.add(path+".count", "must be positive")
+		} else if p.Count.Round(maxCountScale).Cmp(p.Count) != 0 {
+			errs.add(path+".count", fmt.Sprintf("can have at most %d decimal places", maxCountScale))
+		}
+		if p.Unit != "" && p.Unit != Kilogram && p.Unit != Litre && p.Unit != Piece {
+			errs.add(path+".unit", "must be kg, l or pc")
+		}
+		return
+	}
+	if p.Count.Cmp(decimal.Zero) != 0 {
+		errs.add(path+".count", "can not be set along with quantity")
+	}
+	if p.Quantity.Cmp(decimal.Zero) <= 0 || p.Quantity.Cmp(decimal.New(MaxQuantity, 0)) > 0 {
+		errs.add(path+".quantity", fmt.Sprintf("must be positive and at most %d", MaxQuantity))
+	}
+	if p.Unit != Kilogram && p.Unit != Litre {
+		errs.add(path+".unit", "must be kg or l")
+	}
 }
 
 type UserPreference struct {
 	IDs       []ID `json:"id_chain_stores"`
 	MaxStores int  `json:"max_stores"`
+
+	// StoreCost is what visiting one more store is worth to the user,
+	// KmCost is paid for every kilometre travelled when a location is given.
+	StoreCost decimal.Decimal `json:"store_cost"`
+	KmCost    decimal.Decimal `json:"km_cost"`
+
+	// LoyaltyCards lists the chain stores whose loyalty card the user
+	// holds, their card promotions are applied.
+	LoyaltyCards []ID `json:"loyalty_cards,omitempty"`
+}
+
+// VisitCost returns the cost of visiting a store distance kilometres away,
+// the trip there and back is paid per kilometre.
+func (u *UserPreference) VisitCost(distance JsonNullFloat64) decimal.Decimal {
+	c := u.StoreCost
+	if distance.Valid {
+		km := decimal.NewFromFloat(2 * distance.Float64)
+		c = c.Add(u.KmCost.Mul(km))
+	}
+	return c.Round(2)
 }
 
 func (u *UserPreference) Contains(id ID) bool {
@@ -70,6 +175,17 @@ func (u *UserPreference) Contains(id ID) bool {
 	return false
 }
 
+// HasCard reports whether the user holds the loyalty card of the chain
+// store id.
+func (u *UserPreference) HasCard(id ID) bool {
+	for _, cs := range u.LoyaltyCards {
+		if cs.String() == id.String() {
+			return true
+		}
+	}
+	return false
+}
+
 func (u *UserPreference) SetPrefered(IDs []ID) {
 	u.IDs = IDs
 }
@@ -77,27 +193,73 @@ func (u *UserPreference) SetPrefered(IDs []ID) {
 type ShopRequest struct {
 	Products       []ShopRequestProduct `json:"products"`
 	UserPreference UserPreference       `json:"user_preference"`
+
+	// Location of the user, when set stores are picked among the ones
+	// within MaxDistance kilometres, zero MaxDistance means no limit.
+	Location    *Location `json:"location,omitempty"`
+	MaxDistance float64   `json:"max_distance,omitempty"`
+
+	// Partial asks for the basket of the available products when some
+	// can not be bought in the prefered chain stores.
+	Partial bool `json:"partial,omitempty"`
 }
 
-func (s *ShopRequest) ProductCount(id ID) int {
+// Line returns the first line of the product id and its index, nil when
+// the product is not requested.
+func (s *ShopRequest) Line(id ID) (int, *ShopRequestProduct) {
+	for i := range s.Products {
+		if s.Products[i].ID.String() == id.String() {
+			return i, &s.Products[i]
+		}
+	}
+	return -1, nil
+}
+
+// Substitutes reports whether a line of the product id allows substitutes.
+func (s *ShopRequest) Substitutes(id ID) bool {
 	for _, p := range s.Products {
-		if p.ID.String() == id.String() {
-			return p.Count
+		if p.AllowSubstitutes && p.ID.String() == id.String() {
+			return true
 		}
 	}
-	return 0
+	return false
 }
 
 func (s *ShopRequest) Valid() error {
+	var errs ValidationError
 	if len(s.Products) == 0 {
-		return errors.New("at least one product must be added")
+		errs.add("products", "at least one product must be added")
+	}
+	for i, p := range s.Products {
+		p.valid(&errs, fmt.Sprintf("products[%d]", i))
 	}
 	if len(s.UserPreference.IDs) == 0 {
-		return errors.New("at least one Chain Store must be set")
+		errs.add("user_preference.id_chain_stores", "at least one chain store must be set")
 	}
 	if s.UserPreference.MaxStores <= 0 {
-		return errors.New("minimum one Chain Store must be set")
+		errs.add("user_preference.max_stores", "must be positive")
 	}
+	if s.UserPreference.StoreCost.Cmp(decimal.Zero) < 0 {
+		errs.add("user_preference.store_cost", "can not be negative")
+	}
+	if s.UserPreference.KmCost.Cmp(decimal.Zero) < 0 {
+		errs.add("user_preference.km_cost", "can not be negative")
+	}
+	for i, cs := range s.UserPreference.LoyaltyCards {
+		if cs.Null() {
+			errs.add(fmt.Sprintf("user_preference.loyalty_cards[%d]", i), "must be set")
+		}
+	}
+	if s.Location != nil {
+		errs.nest("location", s.Location.Valid())
+	}
+	if s.MaxDistance < 0 {
+		errs.add("max_distance", "can not be negative")
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
 	if s.UserPreference.MaxStores > len(s.UserPreference.IDs) {
 		s.UserPreference.MaxStores = len(s.UserPreference.IDs)
 	}
@@ -110,21 +272,112 @@ type ShopProduct struct {
 	ChainStore   string          `json:"-"`
 	Product      string          `json:"product_name"`
 	Brand        string          `json:"brand_name"`
-	Count        int             `json:"count"`
+	Count        decimal.Decimal `json:"count"`
 	PriceDesc    string          `json:"-"`
 	Price        decimal.Decimal `json:"price"`
+
+	// Quantity is the size of one pack in Unit, UnitPrice the price of
+	// one Unit.
+	Quantity  decimal.Decimal `json:"quantity"`
+	Unit      Unit            `json:"unit"`
+	UnitPrice decimal.Decimal `json:"unit_price"`
+
+	// DecimalPossibility is set for products sold by weight.
+	DecimalPossibility bool `json:"-"`
+
+	// Substitute is set when the product is bought in place of the
+	// requested one.
+	Substitute bool `json:"substitute,omitempty"`
+
+	// Variant is the id of the product bought, ID, a product below it or
+	// a substitute. Scope is the one of its price, see PriceScope.
+	Variant ID         `json:"-"`
+	Scope   PriceScope `json:"-"`
+
+	// Promotions of the product in its chain store valid now, Promotion is
+	// the one Price was lowered by from RegularPrice.
+	Promotions   []Promotion      `json:"-"`
+	Promotion    *Promotion       `json:"promotion,omitempty"`
+	RegularPrice *decimal.Decimal `json:"regular_price,omitempty"`
+}
+
+// MarshalJSON encodes Count as a number, as it was when counts were whole,
+// the other decimals stay strings.
+func (p ShopProduct) MarshalJSON() ([]byte, error) {
+	type shopProduct ShopProduct
+	return json.Marshal(struct {
+		shopProduct
+		Count json.Number `json:"count"`
+	}{shopProduct(p), json.Number(p.Count.String())})
 }
 
 type ShopStore struct {
-	ID             ID            `json:"-"`
-	ChainStoreName string        `json:"chain_store_name"`
-	Products       []ShopProduct `json:"products"`
+	ID             ID              `json:"-"`
+	ChainStoreName string          `json:"chain_store_name"`
+	Store          *Store          `json:"store,omitempty"`
+	Distance       JsonNullFloat64 `json:"distance"`
+	Products       []ShopProduct   `json:"products"`
+
+	// TravelCost is the cost of visiting the store, Saving how much more
+	// the products would cost in the other stores of the shop. Saving is
+	// null when some product can not be bought elsewhere.
+	TravelCost decimal.Decimal  `json:"travel_cost"`
+	Saving     *decimal.Decimal `json:"saving"`
+	// Discount is how much the promotions of the store lower the price of
+	// its products.
+	Discount decimal.Decimal `json:"discount"`
 	// PriceTotal     decimal.Decimal `json:"store_price_total"`
 }
 
+// ChainOffer is the price of a product in a chain store, for the requested
+// count.
+type ChainOffer struct {
+	IDChainStore   ID              `json:"id_chain_store"`
+	ChainStoreName string          `json:"chain_store_name"`
+	Product        string          `json:"product_name"`
+	Brand          string          `json:"brand_name"`
+	Price          decimal.Decimal `json:"price"`
+}
+
+// UnavailableProduct is a requested product the prefered chain stores do
+// not sell, Offers lists the other chain stores selling it, cheapest first.
+type UnavailableProduct struct {
+	ID     ID           `json:"id_product"`
+	Offers []ChainOffer `json:"offers"`
+}
+
+// Substitution is a product bought in place of the requested one. Saving
+// is how much cheaper it is than the requested product in the prefered
+// chain stores, null when they do not sell it.
+type Substitution struct {
+	ID             ID               `json:"id_product"`
+	ChainStoreName string           `json:"chain_store_name"`
+	Product        string           `json:"product_name"`
+	Brand          string           `json:"brand_name"`
+	Price          decimal.Decimal  `json:"price"`
+	Saving         *decimal.Decimal `json:"saving"`
+}
+
+// Codes of the shops that can not be bought, products the prefered chain
+// stores do not sell or products not sold together within max_stores.
+const (
+	ShopUnavailable = "unavailable_products"
+	ShopMaxStores   = "max_stores_exceeded"
+)
+
 type Shop struct {
 	Error string `json:"error,omitempty"`
+	// Code is one of the Shop codes when Error is set.
+	Code string `json:"code,omitempty"`
+	// Unavailable lists the products that can not be bought, they are
+	// left out of a partial shop.
+	Unavailable []UnavailableProduct `json:"unavailable,omitempty"`
 
 	Stores     []ShopStore     `json:"stores,omitempty"`
 	PriceTotal decimal.Decimal `json:"shop_price_total,omitempty"`
+	TravelCost decimal.Decimal `json:"travel_cost"`
+	// Optimal reports whether PriceTotal is proven to be the cheapest basket.
+	Optimal bool `json:"optimal"`
+
+	Substitutions []Substitution `json:"substitutions,omitempty"`
 }
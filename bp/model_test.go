@@ -0,0 +1,39 @@
+package bp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// TestShopProductJSON pins the wire format of POST /shop: counts are
+// numbers, prices strings.
+func TestShopProductJSON(t *testing.T) {
+	cases := []struct {
+		count string
+		want  []string
+	}{
+		{"2", []string{`"count":2`, `"price":"3.99"`}},
+		{"0.75", []string{`"count":0.75`, `"price":"3.99"`}},
+	}
+	for _, tc := range cases {
+		count, err := decimal.NewFromString(tc.count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(ShopProduct{ID: RandID(), Count: count, Price: decimal.New(399, -2)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range tc.want {
+			if !strings.Contains(string(b), w) {
+				t.Errorf("Marshal(count %s) = %s, want %s", tc.count, b, w)
+			}
+		}
+		if strings.Count(string(b), `"count"`) != 1 {
+			t.Errorf("Marshal(count %s) = %s, want one count", tc.count, b)
+		}
+	}
+}
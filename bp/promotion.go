@@ -0,0 +1,102 @@
+package bp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PromotionKind is the rule a promotion prices the packs of a product by.
+type PromotionKind string
+
+const (
+	// PromotionPrice sells every pack for Price.
+	PromotionPrice PromotionKind = "price"
+	// PromotionMultiBuy sells every Buy packs for the price of Pay, 2 for 1
+	// is Buy 2 Pay 1.
+	PromotionMultiBuy PromotionKind = "multi_buy"
+	// PromotionNthDiscount takes Percent off every Buy-th pack, the 3rd
+	// -50% is Buy 3 Percent 50.
+	PromotionNthDiscount PromotionKind = "nth_discount"
+)
+
+// Promotion lowers the price of a product in a chain store from ValidFrom
+// until ValidTo, null ValidTo meaning until removed. LoyaltyCard promotions
+// are given to holders of the card of the chain store only.
+type Promotion struct {
+	ID           ID               `json:"id_promotion"`
+	IDProduct    ID               `json:"id_product"`
+	IDChainStore ID               `json:"id_chain_store"`
+	Kind         PromotionKind    `json:"kind"`
+	Price        *decimal.Decimal `json:"price,omitempty"`
+	Buy          int              `json:"buy,omitempty"`
+	Pay          int              `json:"pay,omitempty"`
+	Percent      int              `json:"percent,omitempty"`
+	LoyaltyCard  bool             `json:"loyalty_card"`
+	ValidFrom    time.Time        `json:"valid_from"`
+	ValidTo      *time.Time       `json:"valid_to"`
+}
+
+func (p *Promotion) Valid() error {
+	if p.IDProduct.Null() {
+		return errors.New("product must be set")
+	}
+	if p.IDChainStore.Null() {
+		return errors.New("chain store must be set")
+	}
+	switch p.Kind {
+	case PromotionPrice:
+		if p.Price == nil || p.Price.Cmp(decimal.Zero) <= 0 {
+			return errors.New("price must be positive")
+		}
+		if p.Buy != 0 || p.Pay != 0 || p.Percent != 0 {
+			return errors.New("buy, pay and percent can not be set with a price")
+		}
+	case PromotionMultiBuy:
+		if p.Pay < 1 || p.Buy <= p.Pay {
+			return errors.New("pay must be positive and less than buy")
+		}
+		if p.Price != nil || p.Percent != 0 {
+			return errors.New("price and percent can not be set with buy and pay")
+		}
+	case PromotionNthDiscount:
+		if p.Buy < 1 || p.Percent < 1 || p.Percent > 100 {
+			return errors.New("buy must be positive and percent between 1 and 100")
+		}
+		if p.Price != nil || p.Pay != 0 {
+			return errors.New("price and pay can not be set with a discount")
+		}
+	default:
+		return errors.New("kind must be price, multi_buy or nth_discount")
+	}
+	if p.ValidTo != nil && !p.ValidTo.After(p.ValidFrom) {
+		return errors.New("valid_to must be after valid_from")
+	}
+	return nil
+}
+
+// Active reports whether the promotion is valid at t.
+func (p *Promotion) Active(t time.Time) bool {
+	return !t.Before(p.ValidFrom) && (p.ValidTo == nil || t.Before(*p.ValidTo))
+}
+
+// Apply returns the price of count packs sold for price each, rounded to
+// grosz. Fractions of a pack are sold at the regular or promotion price,
+// multi-buys and discounts count whole packs only.
+func (p *Promotion) Apply(price, count decimal.Decimal) decimal.Decimal {
+	switch p.Kind {
+	case PromotionPrice:
+		return p.Price.Mul(count).Round(2)
+	case PromotionMultiBuy:
+		buy := decimal.New(int64(p.Buy), 0)
+		sets := count.Div(buy).Floor()
+		paid := count.Sub(sets.Mul(buy)).Add(sets.Mul(decimal.New(int64(p.Pay), 0)))
+		return price.Mul(paid).Round(2)
+	case PromotionNthDiscount:
+		nth := count.Div(decimal.New(int64(p.Buy), 0)).Floor()
+		off := price.Mul(nth).Mul(decimal.New(int64(p.Percent), -2))
+		return price.Mul(count).Sub(off).Round(2)
+	}
+	return price.Mul(count).Round(2)
+}
@@ -0,0 +1,33 @@
+package bp
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// letters are not decomposed by NFD but stripped by the unaccent extension.
+var letters = strings.NewReplacer("ł", "l", "ø", "o", "đ", "d", "ß", "ss", "æ", "ae", "œ", "oe")
+
+// SearchWords splits s into the words products are searched by. Words are
+// lowercased and stripped of accents and of everything but letters and
+// digits.
+func SearchWords(s string) ([]string, error) {
+	t := transform.Chain(
+		runes.Map(unicode.ToLower),
+		norm.NFD,
+		runes.Remove(runes.In(unicode.Mn)),
+		norm.NFC)
+	s, _, err := transform.String(t, s)
+	if err != nil {
+		return nil, err
+	}
+	s = letters.Replace(s)
+
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), nil
+}
@@ -29,6 +29,10 @@ func RandID() ID {
 }
 
 func (x *ID) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		x.UUID = nil
+		return nil
+	}
 	b = bytes.Trim(b, "\"")
 	uuid, err := uuid.ParseHex(string(b))
 	if err != nil {
@@ -38,7 +42,10 @@ func (x *ID) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func (x *ID) MarshalJSON() ([]byte, error) {
+// MarshalJSON has a value receiver so ids in values that are not
+// addressable, map values and structs stored in interfaces, encode as
+// strings too rather than as the embedded UUID bytes.
+func (x ID) MarshalJSON() ([]byte, error) {
 	if x.UUID == nil {
 		return json.Marshal(nil)
 	}
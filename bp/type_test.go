@@ -0,0 +1,50 @@
+package bp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestIDRoundTrip(t *testing.T) {
+	root := Category{ID: RandID(), Name: "Nabiał"}
+	sub := Category{ID: RandID(), IDParent: root.ID, Name: "Mleko"}
+	for _, want := range []Category{root, sub} {
+		b, err := json.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Category
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", b, err)
+		}
+		if got.ID.String() != want.ID.String() || got.IDParent.Null() != want.IDParent.Null() ||
+			!got.IDParent.Null() && got.IDParent.String() != want.IDParent.String() {
+			t.Errorf("Unmarshal(%s): got %+v, want %+v", b, got, want)
+		}
+	}
+
+	// null clears an id set before
+	id := RandID()
+	if err := json.Unmarshal([]byte("null"), &id); err != nil || !id.Null() {
+		t.Errorf("Unmarshal(null): got null %t, %v, want null id", id.Null(), err)
+	}
+}
+
+func TestIDMarshalValue(t *testing.T) {
+	id := RandID()
+	want := `"` + id.String() + `"`
+	for _, v := range []interface{}{
+		id,
+		map[string]ID{"id": id},
+		map[string]Category{"c": {ID: id}},
+	} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), want) {
+			t.Errorf("Marshal(%T) = %s, want the id as %s", v, b, want)
+		}
+	}
+}
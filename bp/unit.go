@@ -0,0 +1,48 @@
+package bp
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// Unit products are compared by, products weighed or measured by volume are
+// priced per kilogram or litre, the others per piece.
+type Unit string
+
+const (
+	Kilogram Unit = "kg"
+	Litre    Unit = "l"
+	Piece    Unit = "pc"
+)
+
+// MaxQuantity is the largest quantity of a product a shop may fill.
+const MaxQuantity = 100
+
+// PackSize returns the size in its unit of a pack weighing weight grams or
+// holding volume millilitres.
+func PackSize(weight, volume JsonNullInt64) (decimal.Decimal, Unit) {
+	switch {
+	case weight.Valid && weight.Int64 > 0:
+		return decimal.New(weight.Int64, -3), Kilogram
+	case volume.Valid && volume.Int64 > 0:
+		return decimal.New(volume.Int64, -3), Litre
+	}
+	return decimal.New(1, 0), Piece
+}
+
+// UnitPrice returns the price of one unit of a pack of size sold for price,
+// rounded to grosz.
+func UnitPrice(price, size decimal.Decimal) decimal.Decimal {
+	return price.Div(size).Round(2)
+}
+
+// Normalize sets the unit of p and, unless price is nil, its lowest price
+// and the price of one unit.
+func (p *Product) Normalize(price *decimal.Decimal) {
+	size, unit := PackSize(p.Weight, p.Volume)
+	p.Unit = unit
+	if price == nil {
+		return
+	}
+	u := UnitPrice(*price, size)
+	p.Price, p.UnitPrice = price, &u
+}
@@ -0,0 +1,71 @@
+package bp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrUnauthorized is returned when credentials or a token are not valid.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// User is an account with an email and password, or an anonymous device
+// account without an email.
+type User struct {
+	ID      ID        `json:"id_user"`
+	Email   string    `json:"email,omitempty"`
+	Created time.Time `json:"created_at"`
+}
+
+type Credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (c *Credentials) Valid() error {
+	c.Email = strings.ToLower(strings.TrimSpace(c.Email))
+	if !strings.Contains(c.Email, "@") {
+		return errors.New("email is not valid")
+	}
+	if len(c.Password) < 8 {
+		return errors.New("password must have at least 8 characters")
+	}
+	return nil
+}
+
+// Session is a token authenticating the user as a bearer token until it
+// expires.
+type Session struct {
+	Token   string    `json:"token"`
+	User    User      `json:"user"`
+	Expires time.Time `json:"expires_at"`
+}
+
+// ShoppingList is a named basket saved with the preferences to shop it with.
+type ShoppingList struct {
+	ID             ID                   `json:"id_list"`
+	Name           string               `json:"name"`
+	Products       []ShopRequestProduct `json:"products"`
+	UserPreference UserPreference       `json:"user_preference"`
+	Updated        time.Time            `json:"updated_at"`
+}
+
+func (l *ShoppingList) Valid() error {
+	var errs ValidationError
+	if strings.TrimSpace(l.Name) == "" {
+		errs.add("name", "must be set")
+	}
+	for i, p := range l.Products {
+		p.valid(&errs, fmt.Sprintf("products[%d]", i))
+	}
+	return errs.err()
+}
+
+// ShopRequest returns the request shopping the list.
+func (l *ShoppingList) ShopRequest() ShopRequest {
+	return ShopRequest{
+		Products:       l.Products,
+		UserPreference: l.UserPreference,
+	}
+}
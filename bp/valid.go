@@ -0,0 +1,47 @@
+package bp
+
+import "strings"
+
+// FieldError reports why a field of a request is invalid, Field is its
+// JSON path like products[0].count.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists the invalid fields of a request.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, f := range e {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// nest adds the error of the value at path, fields of a ValidationError
+// are prefixed with the path.
+func (e *ValidationError) nest(path string, err error) {
+	switch v := err.(type) {
+	case nil:
+	case ValidationError:
+		for _, f := range v {
+			e.add(path+"."+f.Field, f.Message)
+		}
+	default:
+		e.add(path, err.Error())
+	}
+}
+
+// err returns nil when no field is invalid.
+func (e ValidationError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
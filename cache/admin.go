@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"github.com/BestPrice/backend/bp"
+)
+
+var (
+	_ bp.AdminService  = Admin{}
+	_ bp.ImportService = Imports{}
+)
+
+// Admin invalidates the cache after every successful write of the wrapped
+// service.
+type Admin struct {
+	bp.AdminService
+	Cache *Service
+}
+
+func (a Admin) invalidate(err error) error {
+	if err == nil {
+		a.Cache.Invalidate()
+	}
+	return err
+}
+
+func (a Admin) CreateCategory(c *bp.Category) error {
+	return a.invalidate(a.AdminService.CreateCategory(c))
+}
+
+func (a Admin) UpdateCategory(c *bp.Category) error {
+	return a.invalidate(a.AdminService.UpdateCategory(c))
+}
+
+func (a Admin) DeleteCategory(id bp.ID) error {
+	return a.invalidate(a.AdminService.DeleteCategory(id))
+}
+
+func (a Admin) CreateProduct(p *bp.Product) error {
+	return a.invalidate(a.AdminService.CreateProduct(p))
+}
+
+func (a Admin) UpdateProduct(p *bp.Product) error {
+	return a.invalidate(a.AdminService.UpdateProduct(p))
+}
+
+func (a Admin) DeleteProduct(id bp.ID) error {
+	return a.invalidate(a.AdminService.DeleteProduct(id))
+}
+
+func (a Admin) CreateBrand(b *bp.Brand) error {
+	return a.invalidate(a.AdminService.CreateBrand(b))
+}
+
+func (a Admin) UpdateBrand(b *bp.Brand) error {
+	return a.invalidate(a.AdminService.UpdateBrand(b))
+}
+
+func (a Admin) DeleteBrand(id bp.ID) error {
+	return a.invalidate(a.AdminService.DeleteBrand(id))
+}
+
+func (a Admin) CreateChainstore(c *bp.Chainstore) error {
+	return a.invalidate(a.AdminService.CreateChainstore(c))
+}
+
+func (a Admin) UpdateChainstore(c *bp.Chainstore) error {
+	return a.invalidate(a.AdminService.UpdateChainstore(c))
+}
+
+func (a Admin) DeleteChainstore(id bp.ID) error {
+	return a.invalidate(a.AdminService.DeleteChainstore(id))
+}
+
+func (a Admin) CreateStore(s *bp.Store) error {
+	return a.invalidate(a.AdminService.CreateStore(s))
+}
+
+func (a Admin) UpdateStore(s *bp.Store) error {
+	return a.invalidate(a.AdminService.UpdateStore(s))
+}
+
+func (a Admin) DeleteStore(id bp.ID) error {
+	return a.invalidate(a.AdminService.DeleteStore(id))
+}
+
+// Imports invalidates the cache after every import of the wrapped service.
+type Imports struct {
+	bp.ImportService
+	Cache *Service
+}
+
+func (i Imports) ImportPrices(rows []bp.PriceRow, source string) (bp.ImportReport, error) {
+	r, err := i.ImportService.ImportPrices(rows, source)
+	if err == nil {
+		i.Cache.Invalidate()
+	}
+	return r, err
+}
@@ -0,0 +1,108 @@
+// Package cache keeps the rarely changing catalog of a bp.Service in
+// memory, the chain stores, stores and categories.
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+var _ bp.Service = &Service{}
+
+// entry is a cached result, loaded again once expired or invalidated.
+type entry struct {
+	mu      sync.Mutex
+	value   interface{}
+	expires time.Time
+	version uint64
+}
+
+// get returns the cached value, or the one of load when it is stale. The
+// entry is locked while loading so concurrent misses query the service once.
+func (e *entry) get(s *Service, load func() (interface{}, error)) (interface{}, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	version := s.version()
+	if e.value != nil && e.version == version && time.Now().Before(e.expires) {
+		return e.value, nil
+	}
+	v, err := load()
+	if err != nil {
+		return nil, err
+	}
+	e.value, e.expires, e.version = v, time.Now().Add(s.ttl), version
+	return v, nil
+}
+
+// Service caches the catalog of the wrapped service for TTL, products,
+// shops and price histories are always queried.
+type Service struct {
+	bp.Service
+	ttl time.Duration
+
+	mu sync.Mutex
+	// gen is bumped by Invalidate, entries of older generations are stale
+	gen uint64
+
+	categories, chainstores, stores entry
+}
+
+func New(s bp.Service, ttl time.Duration) *Service {
+	return &Service{Service: s, ttl: ttl}
+}
+
+func (s *Service) version() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gen
+}
+
+// Invalidate drops the cached catalog, the next calls query the service.
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	s.gen++
+	s.mu.Unlock()
+}
+
+// Watch invalidates the cache on every catalog change until events is
+// closed.
+func (s *Service) Watch(events <-chan bp.Event) {
+	for e := range events {
+		if e.Catalog() {
+			s.Invalidate()
+		}
+	}
+}
+
+func (s *Service) Categories() ([]bp.Category, error) {
+	v, err := s.categories.get(s, func() (interface{}, error) {
+		return s.Service.Categories()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]bp.Category{}, v.([]bp.Category)...), nil
+}
+
+func (s *Service) Chainstores() ([]bp.Chainstore, error) {
+	v, err := s.chainstores.get(s, func() (interface{}, error) {
+		return s.Service.Chainstores()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]bp.Chainstore{}, v.([]bp.Chainstore)...), nil
+}
+
+func (s *Service) Stores() ([]bp.Store, error) {
+	v, err := s.stores.get(s, func() (interface{}, error) {
+		return s.Service.Stores()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]bp.Store{}, v.([]bp.Store)...), nil
+}
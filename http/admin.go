@@ -0,0 +1,199 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+func (h Handler) createCategory(w http.ResponseWriter, r *http.Request) error {
+	var c bp.Category
+	if err := decodeValid(r, &c); err != nil {
+		return err
+	}
+	if err := h.Admin.CreateCategory(&c); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return encodeJSON(w, c)
+}
+
+func (h Handler) updateCategory(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	var c bp.Category
+	if err := decodeValid(r, &c); err != nil {
+		return err
+	}
+	c.ID = id
+	if err := h.Admin.UpdateCategory(&c); err != nil {
+		return err
+	}
+	return encodeJSON(w, c)
+}
+
+func (h Handler) deleteCategory(w http.ResponseWriter, r *http.Request) error {
+	return deleteByID(w, r, h.Admin.DeleteCategory)
+}
+
+func (h Handler) createProduct(w http.ResponseWriter, r *http.Request) error {
+	var p bp.Product
+	if err := decodeValid(r, &p); err != nil {
+		return err
+	}
+	if err := h.Admin.CreateProduct(&p); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return encodeJSON(w, p)
+}
+
+func (h Handler) updateProduct(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	var p bp.Product
+	if err := decodeValid(r, &p); err != nil {
+		return err
+	}
+	p.ID = id
+	if err := h.Admin.UpdateProduct(&p); err != nil {
+		return err
+	}
+	return encodeJSON(w, p)
+}
+
+func (h Handler) deleteProduct(w http.ResponseWriter, r *http.Request) error {
+	return deleteByID(w, r, h.Admin.DeleteProduct)
+}
+
+func (h Handler) createBrand(w http.ResponseWriter, r *http.Request) error {
+	var b bp.Brand
+	if err := decodeValid(r, &b); err != nil {
+		return err
+	}
+	if err := h.Admin.CreateBrand(&b); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return encodeJSON(w, b)
+}
+
+func (h Handler) updateBrand(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	var b bp.Brand
+	if err := decodeValid(r, &b); err != nil {
+		return err
+	}
+	b.ID = id
+	if err := h.Admin.UpdateBrand(&b); err != nil {
+		return err
+	}
+	return encodeJSON(w, b)
+}
+
+func (h Handler) deleteBrand(w http.ResponseWriter, r *http.Request) error {
+	return deleteByID(w, r, h.Admin.DeleteBrand)
+}
+
+func (h Handler) createChainstore(w http.ResponseWriter, r *http.Request) error {
+	var c bp.Chainstore
+	if err := decodeValid(r, &c); err != nil {
+		return err
+	}
+	if err := h.Admin.CreateChainstore(&c); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return encodeJSON(w, c)
+}
+
+func (h Handler) updateChainstore(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	var c bp.Chainstore
+	if err := decodeValid(r, &c); err != nil {
+		return err
+	}
+	c.ID = id
+	if err := h.Admin.UpdateChainstore(&c); err != nil {
+		return err
+	}
+	return encodeJSON(w, c)
+}
+
+func (h Handler) deleteChainstore(w http.ResponseWriter, r *http.Request) error {
+	return deleteByID(w, r, h.Admin.DeleteChainstore)
+}
+
+func (h Handler) createStore(w http.ResponseWriter, r *http.Request) error {
+	var s bp.Store
+	if err := decodeValid(r, &s); err != nil {
+		return err
+	}
+	if err := h.Admin.CreateStore(&s); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return encodeJSON(w, s)
+}
+
+func (h Handler) updateStore(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	var s bp.Store
+	if err := decodeValid(r, &s); err != nil {
+		return err
+	}
+	s.ID = id
+	if err := h.Admin.UpdateStore(&s); err != nil {
+		return err
+	}
+	return encodeJSON(w, s)
+}
+
+func (h Handler) deleteStore(w http.ResponseWriter, r *http.Request) error {
+	return deleteByID(w, r, h.Admin.DeleteStore)
+}
+
+func (h Handler) createPromotion(w http.ResponseWriter, r *http.Request) error {
+	var p bp.Promotion
+	if err := decodeValid(r, &p); err != nil {
+		return err
+	}
+	if err := h.Admin.CreatePromotion(&p); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return encodeJSON(w, p)
+}
+
+func (h Handler) updatePromotion(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	var p bp.Promotion
+	if err := decodeValid(r, &p); err != nil {
+		return err
+	}
+	p.ID = id
+	if err := h.Admin.UpdatePromotion(&p); err != nil {
+		return err
+	}
+	return encodeJSON(w, p)
+}
+
+func (h Handler) deletePromotion(w http.ResponseWriter, r *http.Request) error {
+	return deleteByID(w, r, h.Admin.DeletePromotion)
+}
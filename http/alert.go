@@ -0,0 +1,59 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+func (h Handler) alerts(w http.ResponseWriter, r *http.Request) error {
+	v, err := h.Alerts.Alerts(r.URL.Query().Get("subscriber"))
+	if err != nil {
+		return err
+	}
+	return encodeJSON(w, v)
+}
+
+func (h Handler) alert(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	v, err := h.Alerts.Alert(id)
+	if err != nil {
+		return err
+	}
+	return encodeJSON(w, v)
+}
+
+func (h Handler) createAlert(w http.ResponseWriter, r *http.Request) error {
+	var a bp.Alert
+	if err := decodeValid(r, &a); err != nil {
+		return err
+	}
+	if err := h.Alerts.CreateAlert(&a); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return encodeJSON(w, a)
+}
+
+func (h Handler) updateAlert(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	var a bp.Alert
+	if err := decodeValid(r, &a); err != nil {
+		return err
+	}
+	a.ID = id
+	if err := h.Alerts.UpdateAlert(&a); err != nil {
+		return err
+	}
+	return encodeJSON(w, a)
+}
+
+func (h Handler) deleteAlert(w http.ResponseWriter, r *http.Request) error {
+	return deleteByID(w, r, h.Alerts.DeleteAlert)
+}
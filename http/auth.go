@@ -0,0 +1,105 @@
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+// authHandler passes only the requests bearing an API key with the scope,
+// or the admin token.
+type authHandler struct {
+	http.Handler
+	scope bp.Scope
+	keys  bp.KeyService
+	token string
+}
+
+func bearer(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[len("Bearer "):])
+}
+
+func (h authHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	fail := error(statusError{errors.New("missing or unknown API key"), http.StatusUnauthorized})
+	if secret := bearer(req); secret != "" {
+		if h.token != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(h.token)) == 1 {
+			h.Handler.ServeHTTP(rw, req)
+			return
+		}
+		if h.keys != nil {
+			k, err := h.keys.Authenticate(secret)
+			switch {
+			case err == nil && k.Allows(h.scope):
+				h.Handler.ServeHTTP(rw, req)
+				return
+			case err == nil:
+				fail = statusError{fmt.Errorf("API key lacks the %s scope", h.scope), http.StatusForbidden}
+			case err != bp.ErrNotFound:
+				fail = err
+			}
+		}
+	}
+	rw.Header().Set("WWW-Authenticate", `Bearer realm="bestprice"`)
+	writeError(rw, fail)
+}
+
+// auth registers a route requiring scope. Without keys nor admin token
+// configured read routes are open and the others disabled.
+func (h *Handler) auth(scope bp.Scope, path string, f handlerFunc, method string) {
+	if h.Keys == nil && h.AdminToken == "" {
+		if scope == bp.ScopeRead {
+			h.Handle(path, errorHandler(f)).Methods(method)
+		}
+		return
+	}
+	h.Handle(path, authHandler{
+		Handler: errorHandler(f),
+		scope:   scope,
+		keys:    h.Keys,
+		token:   h.AdminToken,
+	}).Methods(method)
+}
+
+func (h Handler) keys(w http.ResponseWriter, r *http.Request) error {
+	v, err := h.Keys.Keys()
+	if err != nil {
+		return err
+	}
+	return encodeJSON(w, v)
+}
+
+func (h Handler) createKey(w http.ResponseWriter, r *http.Request) error {
+	var k bp.APIKey
+	if err := decodeValid(r, &k); err != nil {
+		return err
+	}
+	if err := h.Keys.CreateKey(&k); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return encodeJSON(w, k)
+}
+
+func (h Handler) rotateKey(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	k, err := h.Keys.RotateKey(id)
+	if err != nil {
+		return err
+	}
+	return encodeJSON(w, k)
+}
+
+func (h Handler) revokeKey(w http.ResponseWriter, r *http.Request) error {
+	return deleteByID(w, r, h.Keys.RevokeKey)
+}
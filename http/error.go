@@ -0,0 +1,127 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+// Codes of the error responses.
+const (
+	codeInvalidRequest = "invalid_request"
+	codeUnauthorized   = "unauthorized"
+	codeForbidden      = "forbidden"
+	codeNotFound       = "not_found"
+	codeConflict       = "conflict"
+	codeUnavailable    = bp.ShopUnavailable
+	codeMaxStores      = bp.ShopMaxStores
+	codeInternal       = "internal"
+)
+
+// statusError is an error answered with the status.
+type statusError struct {
+	error
+	status int
+}
+
+// shopError is a shop that can not be bought.
+type shopError struct {
+	shop bp.Shop
+}
+
+func (e shopError) Error() string {
+	return e.shop.Error
+}
+
+// apiError is the body of error responses, Fields lists the invalid fields
+// of the request and Unavailable the products a shop is missing.
+type apiError struct {
+	Code        string                  `json:"code"`
+	Message     string                  `json:"message"`
+	Fields      []bp.FieldError         `json:"fields,omitempty"`
+	Unavailable []bp.UnavailableProduct `json:"unavailable,omitempty"`
+}
+
+type errorBody struct {
+	Error apiError `json:"error"`
+}
+
+func errorCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusUnprocessableEntity:
+		return codeUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return codeInternal
+	}
+	return codeInvalidRequest
+}
+
+// writeError answers the request with err in a JSON envelope. Messages of
+// internal errors are logged, not sent.
+func writeError(rw http.ResponseWriter, err error) {
+	var (
+		status      = http.StatusInternalServerError
+		code        string
+		unavailable []bp.UnavailableProduct
+	)
+	switch e := err.(type) {
+	case statusError:
+		status = e.status
+	case shopError:
+		status = http.StatusUnprocessableEntity
+		code = e.shop.Code
+		unavailable = e.shop.Unavailable
+	case bp.ConflictError:
+		status = http.StatusConflict
+	default:
+		if err == bp.ErrNotFound {
+			status = http.StatusNotFound
+		}
+	}
+
+	var fields bp.ValidationError
+	if errors.As(err, &fields) && status == http.StatusInternalServerError {
+		status = http.StatusBadRequest
+	}
+	if code == "" {
+		code = errorCode(status)
+	}
+	body := apiError{
+		Code:        code,
+		Message:     err.Error(),
+		Fields:      fields,
+		Unavailable: unavailable,
+	}
+	if status >= http.StatusInternalServerError {
+		log.Println(err)
+		body.Message = http.StatusText(status)
+	}
+
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(status)
+	encodeJSON(rw, errorBody{body})
+}
+
+type errorHandler handlerFunc
+
+func (h errorHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if err := h(rw, req); err != nil {
+		writeError(rw, err)
+	}
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) error {
+	return statusError{errors.New("no route " + r.Method + " " + r.URL.Path), http.StatusNotFound}
+}
@@ -2,47 +2,58 @@ package http
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/BestPrice/backend/bp"
 	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// dateLayout is the format of dates in query parameters.
+const dateLayout = "2006-01-02"
+
+// defaultLimit and maxLimit bound the size of a page of products.
+const (
+	defaultLimit = 50
+	maxLimit     = 200
 )
 
 type handlerFunc func(rw http.ResponseWriter, req *http.Request) error
 
-type statusError struct {
-	error
-	status int
-}
+type accessControlHandler struct {
+	http.Handler
 
-type errorHandler handlerFunc
+	// origins allowed to make requests, none if empty and any if "*"
+	origins []string
+}
 
-func (h errorHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	if err := h(rw, req); err != nil {
-		log.Println(err)
-		switch err.(type) {
-		case statusError:
-		default:
-			code := http.StatusInternalServerError
-			http.Error(rw, http.StatusText(code), code)
+func (h accessControlHandler) allowed(origin string) bool {
+	for _, o := range h.origins {
+		if o == origin || o == "*" {
+			return true
 		}
 	}
-}
-
-type accessControlHandler struct {
-	http.Handler
+	return false
 }
 
 func (h accessControlHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	if origin := req.Header.Get("Origin"); origin != "" {
+	rw.Header().Add("Vary", "Origin")
+	if origin := req.Header.Get("Origin"); origin != "" && h.allowed(origin) {
 		rw.Header().Set("Access-Control-Allow-Origin", origin)
 		rw.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
 		rw.Header().Set("Access-Control-Allow-Headers",
-			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, If-None-Match")
+		rw.Header().Set("Access-Control-Expose-Headers", "ETag")
 	}
 	// Stop here if its Preflighted OPTIONS request
 	if req.Method == "OPTIONS" {
@@ -51,24 +62,151 @@ func (h accessControlHandler) ServeHTTP(rw http.ResponseWriter, req *http.Reques
 	h.Handler.ServeHTTP(rw, req)
 }
 
+// Services are the backends served by the Handler. Routes of optional
+// services left nil are not registered.
+type Services struct {
+	Service bp.Service
+	Alerts  bp.AlertService
+	Imports bp.ImportService
+	Admin   bp.AdminService
+	Keys    bp.KeyService
+	Users   bp.UserService
+	Events  bp.EventSource
+
+	// AdminToken is a bearer token granting every scope, used to create
+	// the first API keys.
+	AdminToken string
+
+	// Origins allowed to make cross-origin requests, none if empty and
+	// any if it holds "*".
+	Origins []string
+}
+
 type Handler struct {
 	*mux.Router
-	Service bp.Service
+	Services
+
+	stream *streamHub
 }
 
-func NewHandler(service bp.Service) http.Handler {
+func NewHandler(s Services) http.Handler {
 	h := &Handler{
-		Router:  mux.NewRouter(),
-		Service: service,
+		Router:   mux.NewRouter(),
+		Services: s,
 	}
+	h.NotFoundHandler = errorHandler(notFound)
 	h.Handle("/categories", errorHandler(h.categories)).Methods(http.MethodGet)
 	h.Handle("/chainstores", errorHandler(h.chainstores)).Methods(http.MethodGet)
 	h.Handle("/products", errorHandler(h.products)).Methods(http.MethodGet)
+	h.auth(bp.ScopeRead, "/products/{id}/prices", h.prices, http.MethodGet)
 	h.Handle("/stores", errorHandler(h.stores)).Methods(http.MethodGet)
 	h.Handle("/shop", errorHandler(h.shop)).Methods(http.MethodPost)
 	h.Handle("/api", errorHandler(h.api)).Methods(http.MethodGet)
 
-	return &accessControlHandler{h}
+	if h.Alerts != nil {
+		h.auth(bp.ScopeAlerts, "/alerts", h.alerts, http.MethodGet)
+		h.auth(bp.ScopeAlerts, "/alerts", h.createAlert, http.MethodPost)
+		h.auth(bp.ScopeAlerts, "/alerts/{id}", h.alert, http.MethodGet)
+		h.auth(bp.ScopeAlerts, "/alerts/{id}", h.updateAlert, http.MethodPut)
+		h.auth(bp.ScopeAlerts, "/alerts/{id}", h.deleteAlert, http.MethodDelete)
+	}
+	if h.Users != nil {
+		h.Handle("/users", errorHandler(h.register)).Methods(http.MethodPost)
+		h.Handle("/devices", errorHandler(h.registerDevice)).Methods(http.MethodPost)
+		h.Handle("/sessions", errorHandler(h.login)).Methods(http.MethodPost)
+		h.Handle("/sessions", h.withUser(h.logout)).Methods(http.MethodDelete)
+		h.Handle("/lists", h.withUser(h.lists)).Methods(http.MethodGet)
+		h.Handle("/lists", h.withUser(h.createList)).Methods(http.MethodPost)
+		h.Handle("/lists/{id}", h.withUser(h.list)).Methods(http.MethodGet)
+		h.Handle("/lists/{id}", h.withUser(h.updateList)).Methods(http.MethodPut)
+		h.Handle("/lists/{id}", h.withUser(h.deleteList)).Methods(http.MethodDelete)
+		h.Handle("/lists/{id}/shop", h.withUser(h.shopList)).Methods(http.MethodPost)
+	}
+	if h.Events != nil {
+		h.stream = newStreamHub(h.Events)
+		h.Handle("/stream/prices", errorHandler(h.streamPrices)).Methods(http.MethodGet)
+	}
+	if h.Keys != nil {
+		h.auth(bp.ScopeAdmin, "/admin/keys", h.keys, http.MethodGet)
+		h.auth(bp.ScopeAdmin, "/admin/keys", h.createKey, http.MethodPost)
+		h.auth(bp.ScopeAdmin, "/admin/keys/{id}/rotate", h.rotateKey, http.MethodPost)
+		h.auth(bp.ScopeAdmin, "/admin/keys/{id}", h.revokeKey, http.MethodDelete)
+	}
+	if h.Imports != nil {
+		h.auth(bp.ScopeImport, "/admin/prices/import", h.importPrices, http.MethodPost)
+	}
+	if h.Admin != nil {
+		h.auth(bp.ScopeAdmin, "/admin/categories", h.createCategory, http.MethodPost)
+		h.auth(bp.ScopeAdmin, "/admin/categories/{id}", h.updateCategory, http.MethodPut)
+		h.auth(bp.ScopeAdmin, "/admin/categories/{id}", h.deleteCategory, http.MethodDelete)
+		h.auth(bp.ScopeAdmin, "/admin/products", h.createProduct, http.MethodPost)
+		h.auth(bp.ScopeAdmin, "/admin/products/{id}", h.updateProduct, http.MethodPut)
+		h.auth(bp.ScopeAdmin, "/admin/products/{id}", h.deleteProduct, http.MethodDelete)
+		h.auth(bp.ScopeAdmin, "/admin/brands", h.createBrand, http.MethodPost)
+		h.auth(bp.ScopeAdmin, "/admin/brands/{id}", h.updateBrand, http.MethodPut)
+		h.auth(bp.ScopeAdmin, "/admin/brands/{id}", h.deleteBrand, http.MethodDelete)
+		h.auth(bp.ScopeAdmin, "/admin/chainstores", h.createChainstore, http.MethodPost)
+		h.auth(bp.ScopeAdmin, "/admin/chainstores/{id}", h.updateChainstore, http.MethodPut)
+		h.auth(bp.ScopeAdmin, "/admin/chainstores/{id}", h.deleteChainstore, http.MethodDelete)
+		h.auth(bp.ScopeAdmin, "/admin/stores", h.createStore, http.MethodPost)
+		h.auth(bp.ScopeAdmin, "/admin/stores/{id}", h.updateStore, http.MethodPut)
+		h.auth(bp.ScopeAdmin, "/admin/stores/{id}", h.deleteStore, http.MethodDelete)
+		h.auth(bp.ScopeAdmin, "/admin/promotions", h.createPromotion, http.MethodPost)
+		h.auth(bp.ScopeAdmin, "/admin/promotions/{id}", h.updatePromotion, http.MethodPut)
+		h.auth(bp.ScopeAdmin, "/admin/promotions/{id}", h.deletePromotion, http.MethodDelete)
+	}
+
+	return &accessControlHandler{Handler: h, origins: h.Origins}
+}
+
+type validator interface {
+	Valid() error
+}
+
+// decodeValid decodes the JSON request body into v and validates it.
+func decodeValid(r *http.Request, v validator) error {
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return statusError{err, http.StatusBadRequest}
+	}
+	if err := v.Valid(); err != nil {
+		return statusError{err, http.StatusBadRequest}
+	}
+	return nil
+}
+
+// queryInt returns the integer query parameter, or def when it is not set.
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, statusError{fmt.Errorf("%s: %v", name, err), http.StatusBadRequest}
+	}
+	return i, nil
+}
+
+// pathID returns the id variable of the route.
+func pathID(r *http.Request) (bp.ID, error) {
+	id, err := bp.NewID(mux.Vars(r)["id"])
+	if err != nil {
+		return bp.ID{}, statusError{err, http.StatusBadRequest}
+	}
+	return *id, nil
+}
+
+func deleteByID(w http.ResponseWriter, r *http.Request, del func(bp.ID) error) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	if err := del(id); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
 
 func encodeJSON(w io.Writer, v interface{}) error {
@@ -77,36 +215,139 @@ func encodeJSON(w io.Writer, v interface{}) error {
 	return e.Encode(v)
 }
 
+// encodeETag writes v like encodeJSON along with an ETag of the content,
+// clients sending it back in If-None-Match get 304 Not Modified.
+func encodeETag(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, v); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if matchETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// matchETag reports whether the If-None-Match header matches etag, weak
+// validators compare equal.
+func matchETag(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == etag || t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
 func (h Handler) categories(w http.ResponseWriter, r *http.Request) error {
 	v, err := h.Service.Categories()
 	if err != nil {
 		return err
 	}
-	return encodeJSON(w, v)
+	return encodeETag(w, r, v)
 }
 
 func (h Handler) chainstores(w http.ResponseWriter, r *http.Request) error {
 	v, err := h.Service.Chainstores()
 	if err != nil {
-		log.Println(err)
+		return err
 	}
-	return encodeJSON(w, v)
+	return encodeETag(w, r, v)
 }
 
 func (h Handler) products(w http.ResponseWriter, r *http.Request) error {
 
 	phrase, err := url.QueryUnescape(r.URL.Query().Get("search"))
 	if err != nil {
+		return statusError{err, http.StatusBadRequest}
+	}
+
+	var category *bp.ID
+	if v := r.URL.Query().Get("category"); v != "" {
+		if category, err = bp.NewID(v); err != nil {
+			return statusError{fmt.Errorf("category: %v", err), http.StatusBadRequest}
+		}
+	}
+
+	q := bp.ProductQuery{
+		Category: category,
+		Phrase:   phrase,
+		Sort:     r.URL.Query().Get("sort"),
+	}
+	switch q.Sort {
+	case "":
+		q.Sort = bp.SortRank
+	case bp.SortRank, bp.SortUnitPrice:
+	default:
+		return statusError{fmt.Errorf("sort must be %s or %s", bp.SortRank, bp.SortUnitPrice), http.StatusBadRequest}
+	}
+	if q.Limit, err = queryInt(r, "limit", defaultLimit); err != nil {
 		return err
 	}
+	if q.Limit <= 0 {
+		return statusError{errors.New("limit must be positive"), http.StatusBadRequest}
+	}
+	if q.Limit > maxLimit {
+		q.Limit = maxLimit
+	}
+	if q.Offset, err = queryInt(r, "offset", 0); err != nil {
+		return err
+	}
+	if q.Offset < 0 {
+		return statusError{errors.New("offset can not be negative"), http.StatusBadRequest}
+	}
 
-	category, _ := bp.NewID(r.URL.Query().Get("category"))
+	v, err := h.Service.Products(q)
+	if err != nil {
+		return err
+	}
 
-	v, err := h.Service.Products(category, phrase)
+	return encodeETag(w, r, v)
+}
+
+func (h Handler) prices(w http.ResponseWriter, r *http.Request) error {
+	id, err := pathID(r)
 	if err != nil {
 		return err
 	}
 
+	var (
+		q    = r.URL.Query()
+		to   = time.Now()
+		from = to.AddDate(0, 0, -30)
+		step = bp.Daily
+	)
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(dateLayout, v); err != nil {
+			return statusError{err, http.StatusBadRequest}
+		}
+		// include the whole last day
+		to = to.AddDate(0, 0, 1)
+	}
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(dateLayout, v); err != nil {
+			return statusError{err, http.StatusBadRequest}
+		}
+	}
+	if v := q.Get("step"); v != "" {
+		step = bp.Aggregation(v)
+	}
+	if err := step.Valid(); err != nil {
+		return statusError{err, http.StatusBadRequest}
+	}
+
+	v, err := h.Service.PriceHistory(id, from, to, step)
+	if err != nil {
+		return err
+	}
 	return encodeJSON(w, v)
 }
 
@@ -115,23 +356,29 @@ func (h Handler) stores(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	return encodeJSON(w, v)
+	return encodeETag(w, r, v)
 }
 
 func (h Handler) shop(w http.ResponseWriter, r *http.Request) error {
 	var req bp.ShopRequest
 	defer r.Body.Close()
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return err
+		return statusError{err, http.StatusBadRequest}
 	}
+	return h.runShop(w, &req)
+}
 
+func (h Handler) runShop(w http.ResponseWriter, req *bp.ShopRequest) error {
 	if err := req.Valid(); err != nil {
-		return encodeJSON(w, bp.Shop{Error: err.Error()})
+		return statusError{err, http.StatusBadRequest}
 	}
 
-	shop, err := h.Service.Shop(&req)
+	shop, err := h.Service.Shop(req)
 	if err != nil {
-		return encodeJSON(w, bp.Shop{Error: err.Error()})
+		return err
+	}
+	if shop.Error != "" {
+		return shopError{shop}
 	}
 
 	return encodeJSON(w, shop)
@@ -155,25 +402,131 @@ func (h Handler) api(w http.ResponseWriter, r *http.Request) error {
 	buf.WriteString("\n\nGET /chainstores\n")
 	enc.Encode([]bp.Chainstore{bp.Chainstore{}, bp.Chainstore{}})
 
-	buf.WriteString("\n\nGET /products?category=uuid;search=string\n")
+	buf.WriteString("\n\nGET /products?category=uuid;search=string;limit=50;offset=0;sort=rank|unit_price\n")
 	enc.Encode([]bp.Product{bp.Product{}, bp.Product{}})
 
+	buf.WriteString("\n\nGET /products/{id}/prices?from=2006-01-02;to=2006-01-02;step=day|week\n")
+	enc.Encode([]bp.PriceHistory{{Prices: []bp.PricePoint{{}, {}}}})
+
 	buf.WriteString("\n\nGET /stores\n")
 	enc.Encode([]bp.Store{bp.Store{}, bp.Store{}})
 
+	buf.WriteString("\n\nAuthorization: Bearer secret (scope: alerts)\n")
+	buf.WriteString("GET /alerts?subscriber=string\n")
+	enc.Encode([]bp.Alert{bp.Alert{}, bp.Alert{}})
+
+	buf.WriteString("\n\nPOST /alerts, PUT /alerts/{id}\n")
+	enc.Encode(bp.Alert{
+		IDProduct:     bp.RandID(),
+		IDChainStores: []bp.ID{bp.RandID()},
+		TargetPrice:   decimal.New(399, -2),
+		Subscriber:    "string",
+	})
+
+	buf.WriteString("\n\nGET /alerts/{id}, DELETE /alerts/{id}\n")
+	enc.Encode(bp.Alert{})
+
+	buf.WriteString("\n\nAuthorization: Bearer secret (scopes: read for prices, alerts, import, admin for /admin)\n")
+	buf.WriteString("GET /admin/keys, POST /admin/keys, POST /admin/keys/{id}/rotate, DELETE /admin/keys/{id}\n")
+	enc.Encode(bp.APIKey{Scopes: []bp.Scope{bp.ScopeRead, bp.ScopeAlerts, bp.ScopeImport, bp.ScopeAdmin}})
+
+	buf.WriteString("\n\nPOST /admin/prices/import?source=string (text/csv or application/x-ndjson)\n")
+	buf.WriteString(strings.Join(bp.CSVColumns, ",") + "[," + strings.Join(bp.CSVScopeColumns, ",") + "]\n")
+	buf.WriteString("id_store, region or district narrow a price to the stores of the chain store they match\n")
+	enc.Encode(bp.PriceRow{
+		IDChainStore: bp.RandID(),
+		IDProduct:    bp.RandID(),
+		IDBrand:      bp.RandID(),
+		Price:        decimal.New(399, -2),
+		Observed:     time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+	})
+	enc.Encode(bp.ImportReport{Errors: []bp.RowError{bp.RowError{}}})
+
+	buf.WriteString("\n\nPOST /admin/categories, PUT /admin/categories/{id}, DELETE /admin/categories/{id}\n")
+	enc.Encode(bp.Category{IDParent: bp.RandID()})
+
+	buf.WriteString("\n\nPOST /admin/products, PUT /admin/products/{id}, DELETE /admin/products/{id}\n")
+	enc.Encode(bp.Product{IDCategory: bp.RandID(), Brand: bp.Brand{ID: bp.RandID()}})
+
+	buf.WriteString("\n\nPOST /admin/brands, PUT /admin/brands/{id}, DELETE /admin/brands/{id}\n")
+	enc.Encode(bp.Brand{})
+
+	buf.WriteString("\n\nPOST /admin/chainstores, PUT /admin/chainstores/{id}, DELETE /admin/chainstores/{id}\n")
+	enc.Encode(bp.Chainstore{})
+
+	buf.WriteString("\n\nPOST /admin/stores, PUT /admin/stores/{id}, DELETE /admin/stores/{id}\n")
+	enc.Encode(bp.Store{IDChainStore: bp.RandID()})
+
+	buf.WriteString("\n\nPOST /admin/promotions, PUT /admin/promotions/{id}, DELETE /admin/promotions/{id}\n")
+	buf.WriteString("kind price sets price, multi_buy sells buy packs for pay, nth_discount takes percent off every buy-th pack\n")
+	enc.Encode(bp.Promotion{IDProduct: bp.RandID(), IDChainStore: bp.RandID(), Kind: bp.PromotionMultiBuy, Buy: 2, Pay: 1})
+
+	buf.WriteString("\n\nPOST /users, POST /sessions\n")
+	enc.Encode(bp.Credentials{})
+	buf.WriteString("POST /devices\n")
+	enc.Encode(bp.Session{})
+
+	buf.WriteString("\n\nAuthorization: Bearer token, until the session expires_at\n")
+	buf.WriteString("DELETE /sessions ends the session\n")
+	buf.WriteString("GET /lists, POST /lists, GET /lists/{id}, PUT /lists/{id}, DELETE /lists/{id}\n")
+	enc.Encode(bp.ShoppingList{
+		Products: []bp.ShopRequestProduct{{ID: bp.RandID(), Count: decimal.New(1, 0)}},
+		UserPreference: bp.UserPreference{
+			IDs:       []bp.ID{bp.RandID()},
+			MaxStores: 1,
+		},
+	})
+	buf.WriteString("POST /lists/{id}/shop\n")
+	enc.Encode(bp.ShopRequest{Location: &bp.Location{}, MaxDistance: 5})
+
 	buf.WriteString("\n\nPOST /shop\n")
 	enc.Encode(bp.ShopRequest{
 		Products: []bp.ShopRequestProduct{
-			{ID: bp.RandID(), Count: 1},
-			{ID: bp.RandID(), Count: 1},
+			{ID: bp.RandID(), Count: decimal.New(1, 0)},
+			{ID: bp.RandID(), Count: decimal.New(75, -2), Unit: bp.Kilogram},
+			{ID: bp.RandID(), Count: decimal.New(1, 0), AllowSubstitutes: true},
+			{ID: bp.RandID(), Quantity: decimal.New(2, 0), Unit: bp.Kilogram},
 		},
 
 		UserPreference: bp.UserPreference{
 			IDs:       []bp.ID{bp.RandID(), bp.RandID()},
 			MaxStores: 3,
+			StoreCost: decimal.New(2, 0),
+			KmCost:    decimal.New(50, -2),
+
+			LoyaltyCards: []bp.ID{bp.RandID()},
 		},
+
+		Location:    &bp.Location{},
+		MaxDistance: 5,
+		Partial:     true,
 	})
 
+	buf.WriteString("\n\nGET /stream/prices?products=uuid,uuid\n")
+	buf.WriteString("Server-sent price events of the products, resync events ask to query the prices again.\n")
+	buf.WriteString("Reconnecting with Last-Event-ID replays the missed events.\n")
+	enc.Encode(bp.Event{Table: bp.TablePrice, Op: "update", UnitPrice: &decimal.Zero, Observed: &time.Time{}})
+
+	buf.WriteString("\n\nGET /categories, /chainstores, /products and /stores answer with an ETag, sent back in\n")
+	buf.WriteString("If-None-Match it gets 304 Not Modified while the content is unchanged")
+
+	buf.WriteString("\n\nErrors: invalid_request 400, unauthorized 401, forbidden 403, not_found 404, conflict 409,\n")
+	buf.WriteString("unavailable_products 422, max_stores_exceeded 422, internal 500\n")
+	enc.Encode(errorBody{apiError{
+		Code:    codeInvalidRequest,
+		Message: "products[0].count: must be positive",
+		Fields:  []bp.FieldError{{Field: "products[0].count", Message: "must be positive"}},
+	}})
+	enc.Encode(errorBody{apiError{
+		Code:        codeUnavailable,
+		Message:     "one or more products not available in the prefered chain stores",
+		Unavailable: []bp.UnavailableProduct{{Offers: []bp.ChainOffer{{}}}},
+	}})
+	enc.Encode(errorBody{apiError{
+		Code:    codeMaxStores,
+		Message: "products can not be bought in max_stores chain stores",
+	}})
+
 	_, err := buf.WriteTo(w)
 	return err
 }
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+// maxImportSize limits the size of an uploaded price feed.
+const maxImportSize = 32 << 20
+
+func (h Handler) importPrices(w http.ResponseWriter, r *http.Request) error {
+	defer r.Body.Close()
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var (
+		rows []bp.PriceRow
+		bad  []bp.RowError
+		err  error
+	)
+	switch ct {
+	case "text/csv":
+		rows, bad, err = bp.ReadPriceCSV(body)
+	case "application/x-ndjson", "application/json":
+		rows, bad, err = bp.ReadPriceNDJSON(body)
+	default:
+		err = fmt.Errorf("unsupported content type %q, use text/csv or application/x-ndjson", ct)
+	}
+	if err != nil {
+		return statusError{err, http.StatusBadRequest}
+	}
+
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		source = "import"
+	}
+	report, err := h.Imports.ImportPrices(rows, source)
+	if err != nil {
+		return err
+	}
+	report.AddErrors(bad)
+
+	return encodeJSON(w, report)
+}
@@ -0,0 +1,235 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+const (
+	// streamBacklog is the number of price events kept to be replayed to
+	// reconnecting clients.
+	streamBacklog = 1024
+	// streamBuffer is the number of events a client may lag behind before
+	// it is disconnected, to reconnect and catch up from the backlog.
+	streamBuffer = 64
+	// maxStreamProducts bounds the products watched by one client.
+	maxStreamProducts = 100
+
+	heartbeat   = 15 * time.Second
+	streamRetry = 3 * time.Second
+)
+
+// streamEvent is a price event numbered in the order it was received.
+type streamEvent struct {
+	seq   uint64
+	event bp.Event
+}
+
+type streamClient struct {
+	products map[string]bool
+	events   chan streamEvent
+}
+
+func (c *streamClient) wants(e bp.Event) bool {
+	return e.Op == bp.EventResync || c.products[e.IDProduct.String()]
+}
+
+// streamHub fans the price events out to the clients streaming them. Event
+// ids are <epoch>-<seq>, the epoch changing every time the server starts.
+type streamHub struct {
+	epoch string
+
+	mu      sync.Mutex
+	seq     uint64
+	backlog []streamEvent
+	clients map[*streamClient]bool
+}
+
+func newStreamHub(s bp.EventSource) *streamHub {
+	h := &streamHub{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		clients: make(map[*streamClient]bool),
+	}
+	go h.run(s.Subscribe())
+	return h
+}
+
+func (h *streamHub) run(events <-chan bp.Event) {
+	for e := range events {
+		if e.Price() {
+			h.publish(e)
+		}
+	}
+}
+
+func (h *streamHub) publish(e bp.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	se := streamEvent{h.seq, e}
+	h.backlog = append(h.backlog, se)
+	if len(h.backlog) > streamBacklog {
+		h.backlog = h.backlog[len(h.backlog)-streamBacklog:]
+	}
+
+	for c := range h.clients {
+		if !c.wants(e) {
+			continue
+		}
+		select {
+		case c.events <- se:
+		default:
+			delete(h.clients, c)
+			close(c.events)
+		}
+	}
+}
+
+// subscribe registers a client of the products and returns the events it
+// missed since the event id last, starting with a resync event when some
+// of them are no longer kept.
+func (h *streamHub) subscribe(products []bp.ID, last string) (c *streamClient, missed []streamEvent) {
+	c = &streamClient{
+		products: make(map[string]bool),
+		events:   make(chan streamEvent, streamBuffer),
+	}
+	for _, id := range products {
+		c.products[id.String()] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = true
+
+	if last == "" {
+		return c, nil
+	}
+	resync := bp.Event{Op: bp.EventResync}
+	epoch, n, _ := strings.Cut(last, "-")
+	seq, err := strconv.ParseUint(n, 10, 64)
+	if err != nil || epoch != h.epoch || seq > h.seq {
+		return c, []streamEvent{{h.seq, resync}}
+	}
+	if len(h.backlog) > 0 && h.backlog[0].seq > seq+1 {
+		missed = append(missed, streamEvent{h.backlog[0].seq - 1, resync})
+	}
+	for _, se := range h.backlog {
+		if se.seq > seq && c.wants(se.event) {
+			missed = append(missed, se)
+		}
+	}
+	return c, missed
+}
+
+func (h *streamHub) unsubscribe(c *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.events)
+	}
+}
+
+// streamProducts returns the ids of the products query parameter, a
+// comma separated list that may be repeated.
+func streamProducts(r *http.Request) ([]bp.ID, error) {
+	var ids []bp.ID
+	for _, v := range r.URL.Query()["products"] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			id, err := bp.NewID(s)
+			if err != nil {
+				return nil, fmt.Errorf("products: %v", err)
+			}
+			ids = append(ids, *id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("products: at least one product must be set")
+	}
+	if len(ids) > maxStreamProducts {
+		return nil, fmt.Errorf("products: at most %d products can be streamed", maxStreamProducts)
+	}
+	return ids, nil
+}
+
+// streamPrices sends the price changes of the products as server-sent
+// events. Clients reconnecting with Last-Event-ID get the events they
+// missed, or a resync event when they must query the prices again.
+func (h Handler) streamPrices(w http.ResponseWriter, r *http.Request) error {
+	products, err := streamProducts(r)
+	if err != nil {
+		return statusError{err, http.StatusBadRequest}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("streaming not supported")
+	}
+
+	c, missed := h.stream.subscribe(products, r.Header.Get("Last-Event-ID"))
+	defer h.stream.unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry/time.Millisecond)
+
+	for _, se := range missed {
+		h.stream.write(w, se)
+	}
+	flusher.Flush()
+
+	ping := time.NewTicker(heartbeat)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case se, ok := <-c.events:
+			// a lagging client is dropped, it catches up when reconnecting
+			if !ok {
+				return nil
+			}
+			if err := h.stream.write(w, se); err != nil {
+				return nil
+			}
+		case <-ping.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return nil
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// write sends the event, price changes as price events and resyncs as
+// resync events. Events without a sequence number have no id.
+func (h *streamHub) write(w http.ResponseWriter, se streamEvent) error {
+	name := "price"
+	if se.event.Op == bp.EventResync {
+		name = bp.EventResync
+	}
+	data, err := json.Marshal(se.event)
+	if err != nil {
+		return err
+	}
+	if se.seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %s-%d\n", h.epoch, se.seq); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+type userFunc func(w http.ResponseWriter, r *http.Request, u bp.User) error
+
+// withUser authenticates the user by the session bearer token.
+func (h Handler) withUser(f userFunc) errorHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		u, err := h.Users.Authenticate(bearer(r))
+		if err == bp.ErrUnauthorized {
+			return statusError{err, http.StatusUnauthorized}
+		}
+		if err != nil {
+			return err
+		}
+		return f(w, r, u)
+	}
+}
+
+func (h Handler) register(w http.ResponseWriter, r *http.Request) error {
+	var c bp.Credentials
+	if err := decodeValid(r, &c); err != nil {
+		return err
+	}
+	s, err := h.Users.Register(c)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return encodeJSON(w, s)
+}
+
+func (h Handler) registerDevice(w http.ResponseWriter, r *http.Request) error {
+	s, err := h.Users.RegisterDevice()
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return encodeJSON(w, s)
+}
+
+func (h Handler) login(w http.ResponseWriter, r *http.Request) error {
+	var c bp.Credentials
+	if err := decodeValid(r, &c); err != nil {
+		return err
+	}
+	s, err := h.Users.Login(c)
+	if err == bp.ErrUnauthorized {
+		return statusError{err, http.StatusUnauthorized}
+	}
+	if err != nil {
+		return err
+	}
+	return encodeJSON(w, s)
+}
+
+func (h Handler) logout(w http.ResponseWriter, r *http.Request, u bp.User) error {
+	if err := h.Users.Logout(bearer(r)); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h Handler) lists(w http.ResponseWriter, r *http.Request, u bp.User) error {
+	v, err := h.Users.Lists(u.ID)
+	if err != nil {
+		return err
+	}
+	return encodeJSON(w, v)
+}
+
+func (h Handler) list(w http.ResponseWriter, r *http.Request, u bp.User) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	v, err := h.Users.List(u.ID, id)
+	if err != nil {
+		return err
+	}
+	return encodeJSON(w, v)
+}
+
+func (h Handler) createList(w http.ResponseWriter, r *http.Request, u bp.User) error {
+	var l bp.ShoppingList
+	if err := decodeValid(r, &l); err != nil {
+		return err
+	}
+	if err := h.Users.CreateList(u.ID, &l); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return encodeJSON(w, l)
+}
+
+func (h Handler) updateList(w http.ResponseWriter, r *http.Request, u bp.User) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	var l bp.ShoppingList
+	if err := decodeValid(r, &l); err != nil {
+		return err
+	}
+	l.ID = id
+	if err := h.Users.UpdateList(u.ID, &l); err != nil {
+		return err
+	}
+	return encodeJSON(w, l)
+}
+
+func (h Handler) deleteList(w http.ResponseWriter, r *http.Request, u bp.User) error {
+	return deleteByID(w, r, func(id bp.ID) error {
+		return h.Users.DeleteList(u.ID, id)
+	})
+}
+
+// shopList shops the saved list, the optional body may give the location
+// to shop around.
+func (h Handler) shopList(w http.ResponseWriter, r *http.Request, u bp.User) error {
+	id, err := pathID(r)
+	if err != nil {
+		return err
+	}
+	l, err := h.Users.List(u.ID, id)
+	if err != nil {
+		return err
+	}
+
+	var where struct {
+		Location    *bp.Location `json:"location"`
+		MaxDistance float64      `json:"max_distance"`
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&where); err != nil && err != io.EOF {
+		return statusError{err, http.StatusBadRequest}
+	}
+
+	req := l.ShopRequest()
+	req.Location = where.Location
+	req.MaxDistance = where.MaxDistance
+	return h.runShop(w, &req)
+}
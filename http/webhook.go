@@ -0,0 +1,39 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+// Webhook delivers triggered alerts by posting them as JSON to URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w *Webhook) Send(a bp.TriggeredAlert) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	c := w.Client
+	if c == nil {
+		c = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := c.Post(w.URL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("http.Webhook: %s responded %s", w.URL, resp.Status)
+	}
+	return nil
+}
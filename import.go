@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+// formats of the import command by file extension
+var formats = map[string]string{
+	".json":   "fixture",
+	".csv":    "csv",
+	".ndjson": "ndjson",
+	".jsonl":  "ndjson",
+}
+
+// input opens the file at path, - is the standard input.
+func input(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return os.Stdin, nil
+	}
+	return os.Open(path)
+}
+
+// printJSON writes v indented to the standard output.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
+
+// importFile loads a fixture with a catalog and its prices, or a CSV or
+// NDJSON price feed into the database.
+func importFile(args []string) error {
+	fs := flags("import")
+	db := database(fs)
+	var (
+		format = fs.String("format", "", "`format` of the file: fixture, csv or ndjson, by default guessed from its extension")
+		source = fs.String("source", "import", "`source` recorded with the prices")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("import takes one file")
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = formats[filepath.Ext(path)]
+	}
+	f, err := input(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		rows []bp.PriceRow
+		bad  []bp.RowError
+	)
+	switch *format {
+	case "fixture":
+		fixture, err := bp.ReadFixture(f)
+		if err != nil {
+			return err
+		}
+		c, err := open(*db)
+		if err != nil {
+			return err
+		}
+		if err := c.Load(fixture, *source); err != nil {
+			return err
+		}
+		fmt.Printf("loaded %d products and %d prices\n", len(fixture.Products), len(fixture.Prices))
+		return nil
+	case "csv":
+		rows, bad, err = bp.ReadPriceCSV(f)
+	case "ndjson":
+		rows, bad, err = bp.ReadPriceNDJSON(f)
+	default:
+		return fmt.Errorf("unknown format of %s, set -format", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	c, err := open(*db)
+	if err != nil {
+		return err
+	}
+	report, err := c.ImportService().ImportPrices(rows, *source)
+	if err != nil {
+		return err
+	}
+	report.AddErrors(bad)
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d of %d rows rejected", len(report.Errors), report.Rows)
+	}
+	return nil
+}
+
+// seed loads the demo catalog, or the one of a fixture, into the database.
+func seed(args []string) error {
+	fs := flags("seed")
+	db := database(fs)
+	path := fs.String("fixture", "", "fixture `file` to load instead of the demo catalog")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fixture := bp.DemoFixture()
+	if *path != "" {
+		var err error
+		if fixture, err = bp.LoadFixture(*path); err != nil {
+			return err
+		}
+	}
+	c, err := open(*db)
+	if err != nil {
+		return err
+	}
+	if err := c.Load(fixture, "seed"); err != nil {
+		return err
+	}
+	fmt.Printf("loaded %d products and %d prices\n", len(fixture.Products), len(fixture.Prices))
+	return nil
+}
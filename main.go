@@ -1,31 +1,121 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strings"
 
-	"github.com/BestPrice/backend/http"
 	"github.com/BestPrice/backend/sql"
 )
 
+// command is a subcommand of the backend, run with the arguments following
+// its name.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"serve":   {"serve [flags]", serve},
+		"migrate": {"migrate [flags] up | down [n] | status", migrate},
+		"import":  {"import [flags] <file>", importFile},
+		"seed":    {"seed [flags]", seed},
+		"shop":    {"shop [flags] <request.json>", shop},
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  backend "+commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, `run "backend <command> -h" for the flags of a command`)
+}
+
 func main() {
+	log.SetFlags(0)
 
-	// open database
-	c := &sql.Client{
-		Path: os.Getenv("DATABASE_URL"),
+	// without a command the server is run
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-	if err := c.Open(); err != nil {
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(args); err != nil {
 		log.Fatal(err)
 	}
+}
 
-	// create server on PORT with handler
-	s := http.Server{
-		Port:    ":" + os.Getenv("PORT"),
-		Handler: http.NewHandler(c.Service()),
+// flags returns the flag set of the command name. Flags bound to an
+// environment variable with env take its value when not given.
+func flags(name string) *flagSet {
+	fs := &flagSet{
+		FlagSet: flag.NewFlagSet(name, flag.ExitOnError),
+		env:     make(map[string]string),
 	}
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: backend "+commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
 
-	// Run backend server
-	if err := s.Run(); err != nil {
-		log.Fatal(err)
+type flagSet struct {
+	*flag.FlagSet
+	env map[string]string
+}
+
+// bind makes the flag name fall back to the environment variable key.
+func (fs *flagSet) bind(name, key string) {
+	f := fs.Lookup(name)
+	f.Usage += " (env " + key + ")"
+	fs.env[name] = key
+}
+
+func (fs *flagSet) Parse(args []string) error {
+	if err := fs.FlagSet.Parse(args); err != nil {
+		return err
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, key := range fs.env {
+		if v := os.Getenv(key); v != "" && !given[name] {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// database adds the -db flag to fs.
+func database(fs *flagSet) *string {
+	url := fs.String("db", "", "postgres connection `url`")
+	fs.bind("db", "DATABASE_URL")
+	return url
+}
+
+// open returns the client of the database at url with its schema migrated.
+func open(url string) (*sql.Client, error) {
+	c := &sql.Client{
+		Path: url,
 	}
+	return c, c.Open()
 }
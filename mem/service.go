@@ -0,0 +1,500 @@
+// Package mem serves the catalog of a fixture from memory, for tests and
+// development without a database.
+package mem
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/BestPrice/backend/solver"
+	"github.com/shopspring/decimal"
+)
+
+var _ bp.Service = &Service{}
+
+// weights of the name, brand and category words of a product, as used by
+// ts_rank for the weights A, B and C
+var weights = [...]float64{1, 0.4, 0.2}
+
+// node is a category or a product of the catalog tree.
+type node struct {
+	id       bp.ID
+	name     string
+	parent   string
+	product  *bp.Product
+	children []*node
+}
+
+// document holds the search words of a product, see product_search.
+type document struct {
+	product bp.Product
+	path    map[string]bool
+	words   [len(weights)][]string
+}
+
+// Service is a read only bp.Service, safe for concurrent use.
+type Service struct {
+	f      *bp.Fixture
+	nodes  map[string]*node
+	roots  []*node
+	chains map[string]bp.Chainstore
+	docs   []document
+
+	// prices holds the latest price of a product in every chain store and
+	// scope, history all the observations of a product
+	prices  map[string][]bp.PriceRow
+	history map[string][]bp.PriceRow
+
+	// promotions of a product in a chain store, keyed by both ids
+	promotions map[[2]string][]bp.Promotion
+}
+
+func NewService(f *bp.Fixture) (*Service, error) {
+	s := &Service{
+		f:       f,
+		nodes:   make(map[string]*node),
+		chains:  make(map[string]bp.Chainstore),
+		prices:  make(map[string][]bp.PriceRow),
+		history: make(map[string][]bp.PriceRow),
+
+		promotions: make(map[[2]string][]bp.Promotion),
+	}
+
+	brands := make(map[string]bp.Brand)
+	for _, b := range f.Brands {
+		brands[b.ID.String()] = b
+	}
+	for _, c := range f.Chainstores {
+		s.chains[c.ID.String()] = c
+	}
+
+	var nodes []*node
+	for _, c := range f.Categories {
+		nodes = append(nodes, &node{id: c.ID, name: c.Name, parent: parent(c.IDParent)})
+	}
+	for i := range f.Products {
+		p := f.Products[i]
+		b, ok := brands[p.Brand.ID.String()]
+		if !ok {
+			return nil, fmt.Errorf("product %s: unknown brand", p.ID)
+		}
+		p.Brand = b
+		nodes = append(nodes, &node{id: p.ID, name: p.Name, parent: parent(p.IDCategory), product: &p})
+	}
+	for _, n := range nodes {
+		s.nodes[n.id.String()] = n
+	}
+	for _, n := range nodes {
+		if n.parent == "" {
+			s.roots = append(s.roots, n)
+			continue
+		}
+		up, ok := s.nodes[n.parent]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown parent %s", n.id, n.parent)
+		}
+		up.children = append(up.children, n)
+	}
+	for _, n := range s.roots {
+		if err := s.index(n, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// chains holds the chain store of every store
+	chains := make(map[string]string)
+	for _, st := range f.Stores {
+		chains[st.ID.String()] = st.IDChainStore.String()
+	}
+	now := time.Now()
+	latest := make(map[[3]string]int)
+	for _, r := range f.Prices {
+		id := r.IDProduct.String()
+		if n, ok := s.nodes[id]; !ok || n.product == nil {
+			return nil, fmt.Errorf("price of unknown product %s", id)
+		}
+		if _, ok := s.chains[r.IDChainStore.String()]; !ok {
+			return nil, fmt.Errorf("price in unknown chain store %s", r.IDChainStore)
+		}
+		if err := r.PriceScope.Valid(); err != nil {
+			return nil, fmt.Errorf("price of %s: %v", id, err)
+		}
+		if r.IDStore != nil && chains[r.IDStore.String()] != r.IDChainStore.String() {
+			return nil, fmt.Errorf("price in store %s not of chain store %s", r.IDStore, r.IDChainStore)
+		}
+		if r.Observed.IsZero() {
+			r.Observed = now
+		}
+		s.history[id] = append(s.history[id], r)
+
+		key := [3]string{id, r.IDChainStore.String(), scope(r.PriceScope)}
+		if i, ok := latest[key]; !ok {
+			latest[key] = len(s.prices[id])
+			s.prices[id] = append(s.prices[id], r)
+		} else if !s.prices[id][i].Observed.After(r.Observed) {
+			s.prices[id][i] = r
+		}
+	}
+
+	for _, p := range f.Promotions {
+		if err := p.Valid(); err != nil {
+			return nil, fmt.Errorf("promotion %s: %v", p.ID, err)
+		}
+		key := [2]string{p.IDProduct.String(), p.IDChainStore.String()}
+		if n, ok := s.nodes[key[0]]; !ok || n.product == nil {
+			return nil, fmt.Errorf("promotion of unknown product %s", key[0])
+		}
+		if _, ok := s.chains[key[1]]; !ok {
+			return nil, fmt.Errorf("promotion in unknown chain store %s", key[1])
+		}
+		s.promotions[key] = append(s.promotions[key], p)
+	}
+
+	return s, nil
+}
+
+// Open returns the service of the fixture stored at path.
+func Open(path string) (*Service, error) {
+	f, err := bp.LoadFixture(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewService(f)
+}
+
+// scope returns a key of the stores s narrows a price to.
+func scope(s bp.PriceScope) string {
+	var store string
+	if s.IDStore != nil {
+		store = s.IDStore.String()
+	}
+	return store + "\x00" + s.Region + "\x00" + s.District
+}
+
+func parent(id bp.ID) string {
+	if id.Null() {
+		return ""
+	}
+	return id.String()
+}
+
+// index adds the products below n to the search documents, chain holds the
+// names and path the ids of the categories above n.
+func (s *Service) index(n *node, chain []string, path []string) error {
+	chain = append(chain[:len(chain):len(chain)], n.name)
+	path = append(path[:len(path):len(path)], n.id.String())
+
+	if p := n.product; p != nil && p.PriceDescription.String != "" {
+		d := document{product: *p, path: make(map[string]bool)}
+		for _, id := range path {
+			d.path[id] = true
+		}
+		for i, text := range []string{p.Name, p.Brand.Name, strings.Join(chain, " ")} {
+			words, err := bp.SearchWords(text)
+			if err != nil {
+				return err
+			}
+			d.words[i] = words
+		}
+		s.docs = append(s.docs, d)
+	}
+
+	for _, c := range n.children {
+		if err := s.index(c, chain, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s Service) Categories() ([]bp.Category, error) {
+	var tree func(nodes []*node) []bp.Category
+	tree = func(nodes []*node) []bp.Category {
+		vals := []bp.Category{}
+		for _, n := range nodes {
+			if n.product != nil {
+				continue
+			}
+			var p bp.ID
+			if n.parent != "" {
+				p = s.nodes[n.parent].id
+			}
+			vals = append(vals, bp.Category{
+				ID:            n.id,
+				IDParent:      p,
+				Name:          n.name,
+				Subcategories: tree(n.children),
+			})
+		}
+		return vals
+	}
+	return tree(s.roots), nil
+}
+
+func (s Service) Chainstores() ([]bp.Chainstore, error) {
+	return append([]bp.Chainstore{}, s.f.Chainstores...), nil
+}
+
+func (s Service) Stores() ([]bp.Store, error) {
+	vals := make([]bp.Store, 0, len(s.f.Stores))
+	for _, st := range s.f.Stores {
+		st.CSName.Valid = true
+		st.CSName.String = s.chains[st.IDChainStore.String()].Name
+		vals = append(vals, st)
+	}
+	return vals, nil
+}
+
+// rank scores how well the words of d match the query words by prefix,
+// name matches weighing most.
+func (d *document) rank(query []string) float64 {
+	var r float64
+	for _, q := range query {
+		for i, words := range d.words {
+			if matches(words, q) {
+				r += weights[i]
+				break
+			}
+		}
+	}
+	return r / float64(len(query))
+}
+
+func matches(words []string, prefix string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Service) Products(q bp.ProductQuery) ([]bp.Product, error) {
+	query, err := bp.SearchWords(q.Phrase)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := make([]bp.Product, 0, 32)
+	for i := range s.docs {
+		d := &s.docs[i]
+		if q.Category != nil && !d.path[q.Category.String()] {
+			continue
+		}
+		p := d.product
+		if len(query) > 0 {
+			if p.Rank = d.rank(query); p.Rank == 0 {
+				continue
+			}
+		}
+		p.Normalize(s.lowest(p.ID))
+		vals = append(vals, p)
+	}
+	sort.SliceStable(vals, func(i, j int) bool {
+		a, b := &vals[i], &vals[j]
+		if q.Sort == bp.SortUnitPrice && (a.UnitPrice == nil) != (b.UnitPrice == nil) {
+			return a.UnitPrice != nil
+		}
+		if q.Sort == bp.SortUnitPrice && a.UnitPrice != nil {
+			if c := a.UnitPrice.Cmp(*b.UnitPrice); c != 0 {
+				return c < 0
+			}
+		}
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID.String() < b.ID.String()
+	})
+
+	if q.Offset >= len(vals) {
+		return vals[:0], nil
+	}
+	vals = vals[q.Offset:]
+	if q.Limit < len(vals) {
+		vals = vals[:q.Limit]
+	}
+	return vals, nil
+}
+
+// lowest returns the lowest current chain wide price of the product id,
+// nil when it is not sold.
+func (s Service) lowest(id bp.ID) *decimal.Decimal {
+	var min *decimal.Decimal
+	for i, r := range s.prices[id.String()] {
+		if r.Empty() && (min == nil || r.Price.Cmp(*min) < 0) {
+			min = &s.prices[id.String()][i].Price
+		}
+	}
+	if min == nil {
+		return nil
+	}
+	price := *min
+	return &price
+}
+
+// active returns the promotions of the product id in the chain store cs
+// valid at t.
+func (s Service) active(id, cs bp.ID, t time.Time) []bp.Promotion {
+	var vals []bp.Promotion
+	for _, p := range s.promotions[[2]string{id.String(), cs.String()}] {
+		if p.Active(t) {
+			vals = append(vals, p)
+		}
+	}
+	return vals
+}
+
+// offers appends the current prices of n and of every product below it,
+// bought for the requested product id.
+func (s Service) offers(p []bp.ShopProduct, id bp.ID, n *node, substitute bool) []bp.ShopProduct {
+	if n.product != nil {
+		now := time.Now()
+		size, unit := bp.PackSize(n.product.Weight, n.product.Volume)
+		for _, r := range s.prices[n.id.String()] {
+			p = append(p, bp.ShopProduct{
+				ID:           id,
+				IDChainStore: r.IDChainStore,
+				ChainStore:   s.chains[r.IDChainStore.String()].Name,
+				Product:      n.product.Name,
+				Brand:        n.product.Brand.Name,
+				PriceDesc:    n.product.PriceDescription.String,
+				Price:        r.Price,
+				Quantity:     size,
+				Unit:         unit,
+				Substitute:   substitute,
+				Promotions:   s.active(n.id, r.IDChainStore, now),
+				Variant:      n.id,
+				Scope:        r.PriceScope,
+
+				DecimalPossibility: n.product.DecimalPossibility.Bool,
+			})
+		}
+	}
+	for _, c := range n.children {
+		p = s.offers(p, id, c, substitute)
+	}
+	return p
+}
+
+// substitutes appends the offers of the products similar to n in its
+// category, bought for n.
+func (s Service) substitutes(p []bp.ShopProduct, n *node) []bp.ShopProduct {
+	up, ok := s.nodes[n.parent]
+	if n.product == nil || n.product.PriceDescription.String == "" || !ok {
+		return p
+	}
+	for _, c := range up.children {
+		if c == n || c.product == nil || c.product.PriceDescription.String == "" ||
+			!n.product.Similar(c.product) {
+			continue
+		}
+		p = s.offers(p, n.id, c, true)
+	}
+	return p
+}
+
+func (s Service) Shop(req *bp.ShopRequest) (bp.Shop, error) {
+	var (
+		p    []bp.ShopProduct
+		seen = make(map[string]bool)
+	)
+	for _, product := range req.Products {
+		id := product.ID.String()
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		n, ok := s.nodes[id]
+		if !ok {
+			continue
+		}
+		p = s.offers(p, product.ID, n, false)
+		if req.Substitutes(product.ID) {
+			p = s.substitutes(p, n)
+		}
+	}
+
+	var stores []bp.Store
+	if req.Location != nil {
+		stores, _ = s.Stores()
+	}
+
+	return solver.Shop(p, stores, req)
+}
+
+// truncate returns the start of the period t falls in, in UTC.
+func truncate(t time.Time, step bp.Aggregation) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if step == bp.Weekly {
+		// weeks start on monday
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+func (s Service) PriceHistory(product bp.ID, from, to time.Time, step bp.Aggregation) ([]bp.PriceHistory, error) {
+	type period struct {
+		chain string
+		start time.Time
+	}
+	var (
+		points = make(map[period]*bp.PricePoint)
+		sums   = make(map[period]decimal.Decimal)
+		keys   []period
+	)
+	for _, r := range s.history[product.String()] {
+		if !r.PriceScope.Empty() || r.Observed.Before(from) || !r.Observed.Before(to) {
+			continue
+		}
+		k := period{r.IDChainStore.String(), truncate(r.Observed, step)}
+		p, ok := points[k]
+		if !ok {
+			p = &bp.PricePoint{Period: k.start, Min: r.Price, Max: r.Price}
+			points[k] = p
+			keys = append(keys, k)
+		}
+		if r.Price.Cmp(p.Min) < 0 {
+			p.Min = r.Price
+		}
+		if r.Price.Cmp(p.Max) > 0 {
+			p.Max = r.Price
+		}
+		p.Observations++
+		sums[k] = sums[k].Add(r.Price)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if na, nb := s.chains[a.chain].Name, s.chains[b.chain].Name; na != nb {
+			return na < nb
+		}
+		if a.chain != b.chain {
+			return a.chain < b.chain
+		}
+		return a.start.Before(b.start)
+	})
+
+	vals := make([]bp.PriceHistory, 0, 8)
+	for _, k := range keys {
+		p := points[k]
+		p.Avg = sums[k].Div(decimal.New(int64(p.Observations), 0)).Round(2)
+		if n := len(vals); n > 0 && vals[n-1].IDChainStore.String() == k.chain {
+			vals[n-1].Prices = append(vals[n-1].Prices, *p)
+			continue
+		}
+		c := s.chains[k.chain]
+		vals = append(vals, bp.PriceHistory{
+			IDChainStore: c.ID,
+			ChainStore:   c.Name,
+			Prices:       []bp.PricePoint{*p},
+		})
+	}
+	return vals, nil
+}
@@ -0,0 +1,18 @@
+package mem
+
+import (
+	"testing"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/BestPrice/backend/bp/bptest"
+)
+
+func TestService(t *testing.T) {
+	s, err := NewService(bp.DemoFixture())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bptest.TestService(s); err != nil {
+		t.Error(err)
+	}
+}
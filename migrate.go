@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BestPrice/backend/sql"
+)
+
+// migrate manages the schema of the database: up applies the pending
+// migrations, down reverts the last n, one by default, and status lists
+// them.
+func migrate(args []string) error {
+	fs := flags("migrate")
+	db := database(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("missing migrate command")
+	}
+
+	c := &sql.Client{
+		Path: *db,
+	}
+	if err := c.Connect(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := c.MigrateUp()
+		for _, m := range done {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+		done, err := c.MigrateDown(n)
+		for _, m := range done {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		status, err := c.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, s := range status {
+			applied := "pending"
+			if s.Applied != nil {
+				applied = s.Applied.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	}
+	fs.Usage()
+	return fmt.Errorf("unknown migrate command %q", args[0])
+}
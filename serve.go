@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/BestPrice/backend/cache"
+	"github.com/BestPrice/backend/http"
+	"github.com/BestPrice/backend/mem"
+)
+
+// serve runs the http server on the database, or on a fixture from memory.
+func serve(args []string) error {
+	fs := flags("serve")
+	db := database(fs)
+	var (
+		port     = fs.String("port", "8080", "`port` to listen on")
+		fixture  = fs.String("fixture", "", "serve the catalog of the fixture `file` without a database")
+		origins  = fs.String("origins", "*", "comma separated `origins` allowed to call the api from browsers, * for any")
+		token    = fs.String("admin-token", "", "`token` granting every scope")
+		interval = fs.Duration("alert-interval", time.Minute, "how often price alerts are evaluated")
+		webhook  = fs.String("alert-webhook", "", "`url` triggered price alerts are posted to")
+		ttl      = fs.Duration("cache-ttl", 5*time.Minute, "how long the catalog is cached, 0 disables the cache")
+	)
+	fs.bind("port", "PORT")
+	fs.bind("fixture", "FIXTURE")
+	fs.bind("origins", "CORS_ORIGINS")
+	fs.bind("admin-token", "ADMIN_TOKEN")
+	fs.bind("alert-interval", "ALERT_INTERVAL")
+	fs.bind("alert-webhook", "ALERT_WEBHOOK_URL")
+	fs.bind("cache-ttl", "CACHE_TTL")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("invalid alert interval %s, must be positive", *interval)
+	}
+
+	services := http.Services{
+		AdminToken: *token,
+	}
+	// any origin is allowed until the deployments set CORS_ORIGINS, as it
+	// was before the origins could be listed
+	if *origins != "" {
+		services.Origins = strings.Split(*origins, ",")
+	}
+	if *origins == "*" {
+		log.Println("serve: cross-origin requests allowed from any origin, set CORS_ORIGINS to restrict them")
+	}
+
+	if *fixture != "" {
+		s, err := mem.Open(*fixture)
+		if err != nil {
+			return err
+		}
+		services.Service = s
+	} else {
+		c, err := open(*db)
+		if err != nil {
+			return err
+		}
+
+		// changes made through every server
+		events, err := c.Listen()
+		if err != nil {
+			return err
+		}
+		defer events.Close()
+
+		// evaluate price alerts in the background
+		w := &alertWorker{
+			Alerts:   c.AlertService(),
+			Interval: *interval,
+			Events:   events.Subscribe(),
+		}
+		if *webhook != "" {
+			w.Webhook = &http.Webhook{URL: *webhook}
+		}
+		go w.Run()
+
+		services.Service = c.Service()
+		services.Alerts = c.AlertService()
+		services.Imports = c.ImportService()
+		services.Admin = c.AdminService()
+		services.Keys = c.KeyService()
+		services.Users = c.UserService()
+		services.Events = events
+
+		// cache the catalog, dropped on every write and on the changes notified
+		// by the database
+		if *ttl > 0 {
+			cached := cache.New(services.Service, *ttl)
+			go cached.Watch(events.Subscribe())
+			services.Service = cached
+			services.Admin = cache.Admin{AdminService: services.Admin, Cache: cached}
+			services.Imports = cache.Imports{ImportService: services.Imports, Cache: cached}
+		}
+	}
+
+	// create server on port with handler
+	s := http.Server{
+		Port:    ":" + *port,
+		Handler: http.NewHandler(services),
+	}
+	return s.Run()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/BestPrice/backend/mem"
+)
+
+// shop prints the basket of a shop request, computed on the database or on
+// a fixture.
+func shop(args []string) error {
+	fs := flags("shop")
+	db := database(fs)
+	fixture := fs.String("fixture", "", "compute the basket on the fixture `file` instead of the database")
+	fs.bind("fixture", "FIXTURE")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("shop takes one request file, - reads the standard input")
+	}
+
+	f, err := input(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var req bp.ShopRequest
+	if err := json.NewDecoder(f).Decode(&req); err != nil {
+		return err
+	}
+	if err := req.Valid(); err != nil {
+		return err
+	}
+
+	var s bp.Service
+	if *fixture != "" {
+		if s, err = mem.Open(*fixture); err != nil {
+			return err
+		}
+	} else {
+		c, err := open(*db)
+		if err != nil {
+			return err
+		}
+		s = c.Service()
+	}
+
+	basket, err := s.Shop(&req)
+	if err != nil {
+		return err
+	}
+	return printJSON(basket)
+}
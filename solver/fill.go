@@ -0,0 +1,111 @@
+package solver
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// Pack is a size of an item sold for Price, sizes are whole grams,
+// millilitres or pieces. Cost, when set, returns the price of count packs,
+// lower than count times Price under multi-buys and discounts.
+type Pack struct {
+	Size  int64
+	Price decimal.Decimal
+	Cost  func(count int) decimal.Decimal
+}
+
+func (p Pack) cost(count int) decimal.Decimal {
+	if p.Cost != nil {
+		return p.Cost(count)
+	}
+	return p.Price.Mul(decimal.New(int64(count), 0))
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// Fill returns how many of every pack to buy for at least quantity at the
+// lowest price, and that price. ok is false when no pack has a size.
+func Fill(packs []Pack, quantity int64) (counts []int, price decimal.Decimal, ok bool) {
+	var g int64
+	for _, p := range packs {
+		if p.Size > 0 {
+			g = gcd(g, p.Size)
+		}
+	}
+	if g == 0 {
+		return nil, decimal.Zero, false
+	}
+
+	// prices[i][c] is the price of c packs i, up to the count covering
+	// quantity alone, buying more never costs less
+	n := int((quantity + g - 1) / g)
+	prices := make([][]decimal.Decimal, len(packs))
+	var scale int32
+	for i, p := range packs {
+		if p.Size <= 0 {
+			continue
+		}
+		size := int(p.Size / g)
+		prices[i] = make([]decimal.Decimal, (n+size-1)/size+1)
+		for c := 1; c < len(prices[i]); c++ {
+			prices[i][c] = p.cost(c)
+			if e := -prices[i][c].Exponent(); e > scale {
+				scale = e
+			}
+		}
+	}
+	if scale > maxScale {
+		scale = maxScale
+	}
+	mul := decimal.New(1, scale)
+
+	// best[i][a] is the lowest price of at least a times g made of the
+	// packs before i, with took[i][a] packs i-1
+	best := make([][]int64, len(packs)+1)
+	took := make([][]int, len(packs)+1)
+	best[0] = make([]int64, n+1)
+	for a := 1; a <= n; a++ {
+		best[0][a] = inf
+	}
+	for i, p := range packs {
+		best[i+1] = make([]int64, n+1)
+		took[i+1] = make([]int, n+1)
+		cost := make([]int64, len(prices[i]))
+		for c := range prices[i] {
+			cost[c] = prices[i][c].Mul(mul).Round(0).IntPart()
+		}
+		for a := 0; a <= n; a++ {
+			best[i+1][a] = best[i][a]
+			for c := 1; c < len(cost); c++ {
+				rest := a - c*int(p.Size/g)
+				if rest < 0 {
+					rest = 0
+				}
+				if best[i][rest] == inf {
+					continue
+				}
+				if v := cost[c] + best[i][rest]; v < best[i+1][a] {
+					best[i+1][a], took[i+1][a] = v, c
+				}
+			}
+		}
+	}
+
+	counts = make([]int, len(packs))
+	for i, a := len(packs), n; i > 0; i-- {
+		c := took[i][a]
+		if c == 0 {
+			continue
+		}
+		counts[i-1] = c
+		price = price.Add(prices[i-1][c])
+		if a -= c * int(packs[i-1].Size/g); a < 0 {
+			a = 0
+		}
+	}
+	return counts, price, true
+}
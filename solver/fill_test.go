@@ -0,0 +1,108 @@
+package solver
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// twoForOne prices count packs of price when every second one is free.
+func twoForOne(price decimal.Decimal) func(int) decimal.Decimal {
+	return func(count int) decimal.Decimal {
+		return price.Mul(decimal.New(int64(count-count/2), 0))
+	}
+}
+
+func TestFill(t *testing.T) {
+	cases := []struct {
+		name     string
+		packs    []Pack
+		quantity int64
+		ok       bool
+		counts   string
+		price    string
+	}{
+		{"one size", []Pack{{Size: 500, Price: price("1.99")}}, 1200,
+			true, "[3]", "5.97"},
+		{"cheapest sizes", []Pack{{Size: 500, Price: price("1.99")}, {Size: 1000, Price: price("3.49")}, {Size: 2000, Price: price("5.99")}}, 2500,
+			true, "[1 0 1]", "7.98"},
+		{"more for less", []Pack{{Size: 500, Price: price("2.99")}, {Size: 1000, Price: price("2.49")}}, 500,
+			true, "[0 1]", "2.49"},
+		{"multi-buy", []Pack{{Size: 500, Price: price("1.99"), Cost: twoForOne(price("1.99"))}, {Size: 2000, Price: price("5.99")}}, 2500,
+			true, "[5 0]", "5.97"},
+		{"no quantity", []Pack{{Size: 500, Price: price("1.99")}}, 0,
+			true, "[0]", "0"},
+		{"no size", []Pack{{Size: 0, Price: price("1.99")}}, 500,
+			false, "[]", "0"},
+	}
+	for _, tc := range cases {
+		counts, p, ok := Fill(tc.packs, tc.quantity)
+		if ok != tc.ok || fmt.Sprint(counts) != tc.counts || p.Cmp(price(tc.price)) != 0 {
+			t.Errorf("%s: got %v for %s (%t), want %s for %s (%t)",
+				tc.name, counts, p, ok, tc.counts, tc.price, tc.ok)
+		}
+	}
+}
+
+// fillBrute returns the lowest price of packs covering quantity, trying
+// every count of every pack up to the one covering quantity alone.
+func fillBrute(packs []Pack, quantity int64) decimal.Decimal {
+	var (
+		best  decimal.Decimal
+		found bool
+	)
+	var try func(i int, size int64, price decimal.Decimal)
+	try = func(i int, size int64, price decimal.Decimal) {
+		if i == len(packs) {
+			if size >= quantity && (!found || price.Cmp(best) < 0) {
+				best, found = price, true
+			}
+			return
+		}
+		for c := 0; int64(c-1)*packs[i].Size < quantity; c++ {
+			p := price
+			if c > 0 {
+				p = p.Add(packs[i].cost(c))
+			}
+			try(i+1, size+int64(c)*packs[i].Size, p)
+		}
+	}
+	try(0, 0, decimal.Zero)
+	return best
+}
+
+func TestFillBrute(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 300; n++ {
+		packs := make([]Pack, 1+r.Intn(3))
+		for i := range packs {
+			packs[i] = Pack{Size: int64(100 * (1 + r.Intn(10))), Price: decimal.New(int64(50+r.Intn(500)), -2)}
+			if r.Intn(2) == 0 {
+				packs[i].Cost = twoForOne(packs[i].Price)
+			}
+		}
+		quantity := int64(100 * (1 + r.Intn(30)))
+		counts, got, ok := Fill(packs, quantity)
+		if !ok {
+			t.Fatalf("fill %d: not ok", n)
+		}
+		var (
+			size  int64
+			price decimal.Decimal
+		)
+		for i, c := range counts {
+			size += int64(c) * packs[i].Size
+			if c > 0 {
+				price = price.Add(packs[i].cost(c))
+			}
+		}
+		if size < quantity || price.Cmp(got) != 0 {
+			t.Errorf("fill %d: counts %v give %d for %s, want at least %d for %s", n, counts, size, price, quantity, got)
+		}
+		if want := fillBrute(packs, quantity); got.Cmp(want) != 0 {
+			t.Errorf("fill %d: got %s, want %s", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package solver
+
+import (
+	"github.com/BestPrice/backend/bp"
+	"github.com/shopspring/decimal"
+)
+
+// promote sets the price of the Count of p, sold for Price a pack, to the
+// lowest of its regular price and the prices of the promotions the user
+// may use.
+func promote(p *bp.ShopProduct, pref *bp.UserPreference) {
+	regular := p.Price.Mul(p.Count).Round(2)
+	price := regular
+	for i := range p.Promotions {
+		promo := &p.Promotions[i]
+		if promo.LoyaltyCard && !pref.HasCard(p.IDChainStore) {
+			continue
+		}
+		if c := promo.Apply(p.Price, p.Count); c.Cmp(price) < 0 {
+			price, p.Promotion = c, promo
+		}
+	}
+	p.Price = price
+	if p.Promotion != nil {
+		p.RegularPrice = &regular
+	}
+}
+
+// packCost returns the price of count packs of p for the user, see Pack.
+func packCost(p bp.ShopProduct, pref *bp.UserPreference) func(count int) decimal.Decimal {
+	return func(count int) decimal.Decimal {
+		q := p
+		q.Count = decimal.New(int64(count), 0)
+		q.Promotion, q.RegularPrice = nil, nil
+		promote(&q, pref)
+		return q.Price
+	}
+}
@@ -0,0 +1,375 @@
+package solver
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/shopspring/decimal"
+)
+
+// nearestStores returns the closest store of every chain store within
+// req.MaxDistance of req.Location, keyed by the chain store id.
+func nearestStores(stores []bp.Store, req *bp.ShopRequest) map[string]bp.ShopStore {
+	near := make(map[string]bp.ShopStore)
+	for i := range stores {
+		store := &stores[i]
+		d := store.Distance(*req.Location)
+		if req.MaxDistance > 0 && d > req.MaxDistance {
+			continue
+		}
+		id := store.IDChainStore.String()
+		if n, ok := near[id]; ok && n.Distance.Float64 <= d {
+			continue
+		}
+		s := bp.ShopStore{
+			ID:             store.IDChainStore,
+			ChainStoreName: store.CSName.String,
+			Store:          store,
+		}
+		s.Distance.Valid = true
+		s.Distance.Float64 = math.Round(d*1000) / 1000
+		near[id] = s
+	}
+	return near
+}
+
+// resolve keeps of every product offered by a chain store the price of
+// the most specific scope matching the store of the chain in near, its
+// chain wide price without a store.
+func resolve(p []bp.ShopProduct, near map[string]bp.ShopStore) []bp.ShopProduct {
+	type offer struct {
+		item, chain, variant string
+	}
+	var (
+		keys = make([]offer, len(p))
+		best = make(map[offer]int)
+		rank = make(map[offer]int)
+	)
+	for i := range p {
+		k := offer{p[i].ID.String(), p[i].IDChainStore.String(), p[i].Variant.String()}
+		keys[i] = k
+		r := p[i].Scope.Specificity(near[k.chain].Store)
+		if r < 0 {
+			continue
+		}
+		if _, ok := best[k]; !ok || r > rank[k] {
+			best[k], rank[k] = i, r
+		}
+	}
+	vals := make([]bp.ShopProduct, 0, len(best))
+	for i, k := range keys {
+		if j, ok := best[k]; ok && j == i {
+			vals = append(vals, p[i])
+		}
+	}
+	return vals
+}
+
+// alternatives holds for every requested product the cheapest offer of each
+// chain store that can not be used for the shop, keyed by chain store id.
+type alternatives map[string]map[string]bp.ChainOffer
+
+// add records the products of line bought for price, a line filling a
+// quantity with several products lists their names.
+func (a alternatives) add(line []bp.ShopProduct, price decimal.Decimal) {
+	p := &line[0]
+	id, cs := p.ID.String(), p.IDChainStore.String()
+	if a[id] == nil {
+		a[id] = make(map[string]bp.ChainOffer)
+	}
+	if o, ok := a[id][cs]; ok && o.Price.Cmp(price) <= 0 {
+		return
+	}
+	var products, brands []string
+	for _, l := range line {
+		products = append(products, l.Product)
+		brands = append(brands, l.Brand)
+	}
+	a[id][cs] = bp.ChainOffer{
+		IDChainStore:   p.IDChainStore,
+		ChainStoreName: p.ChainStore,
+		Product:        strings.Join(products, ", "),
+		Brand:          strings.Join(brands, ", "),
+		Price:          price,
+	}
+}
+
+// offers returns the alternatives for the product id, cheapest first.
+func (a alternatives) offers(id string) []bp.ChainOffer {
+	vals := make([]bp.ChainOffer, 0, len(a[id]))
+	for _, o := range a[id] {
+		vals = append(vals, o)
+	}
+	sort.Slice(vals, func(i, j int) bool {
+		if c := vals[i].Price.Cmp(vals[j].Price); c != 0 {
+			return c < 0
+		}
+		return vals[i].ChainStoreName < vals[j].ChainStoreName
+	})
+	return vals
+}
+
+// Shop finds the cheapest basket of req among the products p offered by the
+// prefered chainstores, every product priced for one pack of its Quantity
+// and carrying the id of the requested product it may be bought for. A
+// requested quantity is filled from the cheapest packs of a chainstore.
+// When req has a location only chainstores with a store among stores close
+// enough are considered and the nearest one is attached to the result.
+//
+// Offers flagged Substitute are similar products bought in place of the
+// requested one, the ones chosen are reported in Substitutions.
+//
+// Products none of the considered chainstores sell are reported in
+// Unavailable along with the other chainstores selling them. The shop is
+// then an error, unless req.Partial asks for the basket of the rest.
+//
+// Prices narrowed to a region, a district or a store apply to the nearest
+// store of their chain, without a location only chain wide prices do.
+//
+// Products are priced with the cheapest of their promotions the user may
+// use, the packs filling a quantity are picked by the promoted price of the
+// number bought.
+//
+// Fractional counts are bought of products sold by weight only, a line
+// none of whose products can be bought in its count or unit is answered
+// with a bp.ValidationError.
+func Shop(p []bp.ShopProduct, stores []bp.Store, req *bp.ShopRequest) (bp.Shop, error) {
+	var near map[string]bp.ShopStore
+	if req.Location != nil {
+		near = nearestStores(stores, req)
+	}
+	p = resolve(p, near)
+
+	prob := Problem{
+		MaxStores: req.UserPreference.MaxStores,
+		StoreCost: make(map[string]decimal.Decimal),
+	}
+
+	// lines holds for every offer of prob the products bought for it, a
+	// count of one product or the packs filling a quantity
+	var (
+		lines     [][]bp.ShopProduct
+		available = make(map[string]bool)
+		others    = make(alternatives)
+		// original holds the cheapest price of every requested product
+		// itself, without substitutes
+		original = make(map[string]decimal.Decimal)
+	)
+	add := func(line []bp.ShopProduct) {
+		var price decimal.Decimal
+		for _, product := range line {
+			price = price.Add(product.Price)
+		}
+		first := &line[0]
+		item, id := first.ID.String(), first.IDChainStore.String()
+		_, ok := near[id]
+		if !req.UserPreference.Contains(first.IDChainStore) || near != nil && !ok {
+			others.add(line, price)
+			return
+		}
+
+		if _, ok := prob.StoreCost[id]; !ok {
+			prob.StoreCost[id] = req.UserPreference.VisitCost(near[id].Distance)
+		}
+		if o, ok := original[item]; !first.Substitute && (!ok || price.Cmp(o) < 0) {
+			original[item] = price
+		}
+		available[item] = true
+		lines = append(lines, line)
+		prob.Offers = append(prob.Offers, Offer{
+			Item:  item,
+			Store: id,
+			Price: price,
+		})
+	}
+
+	// products of a quantity are grouped by chain store, substitutes by
+	// product, and filled from the sizes of every group. Products sold by
+	// weight are bought in the exact quantity instead.
+	type group struct {
+		item, chain, substitute string
+	}
+	var (
+		groups = make(map[group][]bp.ShopProduct)
+		keys   []group
+		// rejected holds why no product of a line could be bought
+		rejected = make(map[string]bp.FieldError)
+	)
+	for i := range p {
+		p[i].UnitPrice = bp.UnitPrice(p[i].Price, p[i].Quantity)
+
+		n, line := req.Line(p[i].ID)
+		if line == nil {
+			continue
+		}
+		item := p[i].ID.String()
+		path := fmt.Sprintf("products[%d]", n)
+		if line.Quantity.Cmp(decimal.Zero) == 0 {
+			if line.Unit != "" && p[i].Unit != line.Unit {
+				rejected[item] = bp.FieldError{Field: path + ".unit", Message: "the product is sold per " + string(p[i].Unit)}
+				continue
+			}
+			if !p[i].DecimalPossibility && line.Count.Round(0).Cmp(line.Count) != 0 {
+				rejected[item] = bp.FieldError{Field: path + ".count", Message: "must be whole, the product is not sold by weight"}
+				continue
+			}
+			p[i].Count = line.Count
+			promote(&p[i], &req.UserPreference)
+			add(p[i : i+1])
+			continue
+		}
+		if p[i].Unit != line.Unit {
+			rejected[item] = bp.FieldError{Field: path + ".unit", Message: "the product is not sold per " + string(line.Unit)}
+			continue
+		}
+		if p[i].DecimalPossibility {
+			p[i].Count = line.Quantity.Div(p[i].Quantity).Round(3)
+			promote(&p[i], &req.UserPreference)
+			add(p[i : i+1])
+			continue
+		}
+		k := group{item: item, chain: p[i].IDChainStore.String()}
+		if p[i].Substitute {
+			k.substitute = p[i].Product + "\x00" + p[i].Brand
+		}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], p[i])
+	}
+	for _, k := range keys {
+		g := groups[k]
+		// sizes in grams or millilitres
+		milli := decimal.New(1000, 0)
+		_, line := req.Line(g[0].ID)
+		packs := make([]Pack, len(g))
+		for i := range g {
+			packs[i] = Pack{
+				Size:  g[i].Quantity.Mul(milli).IntPart(),
+				Price: g[i].Price,
+				Cost:  packCost(g[i], &req.UserPreference),
+			}
+		}
+		counts, _, ok := Fill(packs, line.Quantity.Mul(milli).Ceil().IntPart())
+		if !ok {
+			continue
+		}
+		var bought []bp.ShopProduct
+		for i, n := range counts {
+			if n > 0 {
+				g[i].Count = decimal.New(int64(n), 0)
+				promote(&g[i], &req.UserPreference)
+				bought = append(bought, g[i])
+			}
+		}
+		add(bought)
+	}
+
+	var errs bp.ValidationError
+	for item, e := range rejected {
+		if !available[item] {
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+		return bp.Shop{}, errs
+	}
+
+	var unavailable []bp.UnavailableProduct
+	seen := make(map[string]bool)
+	for _, r := range req.Products {
+		id := r.ID.String()
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if !available[id] {
+			unavailable = append(unavailable, bp.UnavailableProduct{ID: r.ID, Offers: others.offers(id)})
+			continue
+		}
+		prob.Items = append(prob.Items, id)
+	}
+
+	if len(unavailable) > 0 && !req.Partial {
+		return bp.Shop{
+			Error:       "one or more products not available in the prefered chain stores",
+			Code:        bp.ShopUnavailable,
+			Unavailable: unavailable,
+		}, nil
+	}
+	if len(prob.Items) == 0 {
+		return bp.Shop{Unavailable: unavailable, Optimal: true}, nil
+	}
+
+	sol := Solve(&prob)
+	if !sol.Feasible {
+		return bp.Shop{
+			Error:       "products can not be bought in max_stores chain stores",
+			Code:        bp.ShopMaxStores,
+			Unavailable: unavailable,
+		}, nil
+	}
+	var (
+		visits = make([]bp.ShopStore, len(sol.Stores))
+		index  = make(map[string]int)
+	)
+	for i, v := range sol.Stores {
+		index[v.Store] = i
+		visits[i].TravelCost = v.Cost
+		if !v.Required {
+			saving := v.Saving
+			visits[i].Saving = &saving
+		}
+	}
+	var subs []bp.Substitution
+	for _, o := range sol.Offers {
+		line := lines[o]
+		store := &visits[index[line[0].IDChainStore.String()]]
+		if store.Products == nil {
+			if n, ok := near[line[0].IDChainStore.String()]; ok {
+				store.Store = n.Store
+				store.Distance = n.Distance
+			}
+			store.ID = line[0].IDChainStore
+			store.ChainStoreName = line[0].ChainStore
+		}
+		store.Products = append(store.Products, line...)
+		for _, product := range line {
+			if product.RegularPrice != nil {
+				store.Discount = store.Discount.Add(product.RegularPrice.Sub(product.Price))
+			}
+		}
+
+		// substitutes fill a line with one product
+		product := line[0]
+		if !product.Substitute {
+			continue
+		}
+		sub := bp.Substitution{
+			ID:             product.ID,
+			ChainStoreName: product.ChainStore,
+			Product:        product.Product,
+			Brand:          product.Brand,
+			Price:          prob.Offers[o].Price,
+		}
+		if price, ok := original[product.ID.String()]; ok {
+			saving := price.Sub(sub.Price)
+			sub.Saving = &saving
+		}
+		subs = append(subs, sub)
+	}
+
+	return bp.Shop{
+		Stores:     visits,
+		PriceTotal: sol.Total,
+		TravelCost: sol.StoreCost,
+		Optimal:    sol.Optimal,
+
+		Unavailable:   unavailable,
+		Substitutions: subs,
+	}, nil
+}
@@ -0,0 +1,144 @@
+package solver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	milk, bread, flour  = bp.RandID(), bp.RandID(), bp.RandID()
+	flour500, flour2000 = bp.RandID(), bp.RandID()
+	chainA, chainB      = bp.RandID(), bp.RandID()
+)
+
+// offer returns the product id sold by chain for price a pack of size,
+// whole pieces when size is empty.
+func offer(id, chain bp.ID, name, p, size string) bp.ShopProduct {
+	o := bp.ShopProduct{
+		ID:           id,
+		Variant:      id,
+		IDChainStore: chain,
+		ChainStore:   map[bool]string{true: "A", false: "B"}[chain == chainA],
+		Product:      name,
+		Price:        price(p),
+		Quantity:     decimal.New(1, 0),
+		Unit:         bp.Piece,
+	}
+	if size != "" {
+		o.Quantity, o.Unit = price(size), bp.Kilogram
+	}
+	return o
+}
+
+// catalog holds milk and bread sold by both chains and two packs of flour,
+// variants of the product, sold by A.
+func catalog() []bp.ShopProduct {
+	p := []bp.ShopProduct{
+		offer(milk, chainA, "Mleko", "3.00", ""),
+		offer(bread, chainA, "Chleb", "4.00", ""),
+		offer(milk, chainB, "Mleko", "2.00", ""),
+		offer(bread, chainB, "Chleb", "5.00", ""),
+		offer(flour, chainA, "Mąka 0.5", "1.99", "0.5"),
+		offer(flour, chainA, "Mąka 2", "5.99", "2"),
+	}
+	p[4].Variant, p[5].Variant = flour500, flour2000
+	return p
+}
+
+func line(id bp.ID, count string) bp.ShopRequestProduct {
+	return bp.ShopRequestProduct{ID: id, Count: price(count)}
+}
+
+// basket formats the products of the shop as store: count×product.
+func basket(s bp.Shop) string {
+	var vals []string
+	for _, st := range s.Stores {
+		for _, p := range st.Products {
+			vals = append(vals, fmt.Sprintf("%s: %s×%s", st.ChainStoreName, p.Count, p.Product))
+		}
+	}
+	sort.Strings(vals)
+	return strings.Join(vals, ", ")
+}
+
+func TestShop(t *testing.T) {
+	cases := []struct {
+		name   string
+		req    bp.ShopRequest
+		total  string
+		basket string
+	}{
+		{"one store", bp.ShopRequest{
+			Products:       []bp.ShopRequestProduct{line(milk, "1"), line(bread, "1")},
+			UserPreference: bp.UserPreference{MaxStores: 1},
+		}, "7", "A: 1×Chleb, A: 1×Mleko"},
+		{"two stores", bp.ShopRequest{
+			Products:       []bp.ShopRequestProduct{line(milk, "2"), line(bread, "1")},
+			UserPreference: bp.UserPreference{MaxStores: 2},
+		}, "8", "A: 1×Chleb, B: 2×Mleko"},
+		{"store cost", bp.ShopRequest{
+			Products:       []bp.ShopRequestProduct{line(milk, "2"), line(bread, "1")},
+			UserPreference: bp.UserPreference{MaxStores: 2, StoreCost: price("2")},
+		}, "9", "B: 1×Chleb, B: 2×Mleko"},
+		{"prefered chain", bp.ShopRequest{
+			Products:       []bp.ShopRequestProduct{line(milk, "1")},
+			UserPreference: bp.UserPreference{MaxStores: 1, IDs: []bp.ID{chainA}},
+		}, "3", "A: 1×Mleko"},
+		{"quantity", bp.ShopRequest{
+			Products:       []bp.ShopRequestProduct{{ID: flour, Quantity: price("2.5"), Unit: bp.Kilogram}},
+			UserPreference: bp.UserPreference{MaxStores: 1},
+		}, "7.98", "A: 1×Mąka 0.5, A: 1×Mąka 2"},
+	}
+	for _, tc := range cases {
+		shop, err := Shop(catalog(), nil, &tc.req)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if shop.Error != "" || !shop.Optimal || shop.PriceTotal.Cmp(price(tc.total)) != 0 || basket(shop) != tc.basket {
+			t.Errorf("%s: got %s of %s (%s), want %s of %s",
+				tc.name, shop.PriceTotal, basket(shop), shop.Error, tc.total, tc.basket)
+		}
+	}
+}
+
+func TestShopUnavailable(t *testing.T) {
+	req := bp.ShopRequest{
+		Products:       []bp.ShopRequestProduct{line(milk, "1"), line(flour, "1")},
+		UserPreference: bp.UserPreference{MaxStores: 1, IDs: []bp.ID{chainB}},
+	}
+	shop, err := Shop(catalog(), nil, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shop.Code != bp.ShopUnavailable || len(shop.Stores) != 0 || len(shop.Unavailable) != 1 ||
+		shop.Unavailable[0].ID.String() != flour.String() || len(shop.Unavailable[0].Offers) != 1 {
+		t.Errorf("got %+v, want flour unavailable, sold by A", shop)
+	}
+
+	req.Partial = true
+	shop, err = Shop(catalog(), nil, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shop.Error != "" || basket(shop) != "B: 1×Mleko" || len(shop.Unavailable) != 1 {
+		t.Errorf("partial: got %s (%s) without %d products, want B: 1×Mleko without flour",
+			basket(shop), shop.Error, len(shop.Unavailable))
+	}
+}
+
+func TestShopCount(t *testing.T) {
+	req := bp.ShopRequest{
+		Products:       []bp.ShopRequestProduct{line(milk, "0.5")},
+		UserPreference: bp.UserPreference{MaxStores: 1},
+	}
+	_, err := Shop(catalog(), nil, &req)
+	if e, ok := err.(bp.ValidationError); !ok || len(e) != 1 || e[0].Field != "products[0].count" {
+		t.Errorf("got %v, want a validation error of products[0].count", err)
+	}
+}
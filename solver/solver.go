@@ -0,0 +1,418 @@
+// Package solver finds the cheapest way to buy a basket of items when at
+// most a limited number of stores may be visited.
+package solver
+
+import (
+	"math"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultLimit is the number of search nodes explored before Solve gives
+// up on proving optimality and returns the best basket found so far.
+const DefaultLimit = 1 << 16
+
+// maxScale is the number of decimal places prices are compared with.
+const maxScale = 8
+
+const inf = math.MaxInt64
+
+// Offer is a price for which Store sells Item.
+type Offer struct {
+	Item  string
+	Store string
+	Price decimal.Decimal
+}
+
+// Problem is a basket of Items to buy from the Offers of at most MaxStores
+// stores.
+type Problem struct {
+	Items     []string
+	Offers    []Offer
+	MaxStores int
+
+	// StoreCost is the cost of visiting a store, added to the price of the
+	// basket when comparing solutions.
+	StoreCost map[string]decimal.Decimal
+
+	// Limit bounds the branch-and-bound search, zero means DefaultLimit.
+	Limit int
+}
+
+// Visit is a store of the solution.
+type Visit struct {
+	Store string
+	Cost  decimal.Decimal
+
+	// Saving is how much more the items would cost if they were bought in
+	// the other visited stores only. Required is set instead when some
+	// item is not sold by any of them.
+	Saving   decimal.Decimal
+	Required bool
+}
+
+// Solution is the basket Solve picked for a Problem.
+type Solution struct {
+	// Stores visited, in the order of their first offer in Problem.Offers.
+	Stores []Visit
+	// Offers holds for every Problem.Items entry the index of the chosen
+	// offer in Problem.Offers.
+	Offers []int
+	// Total is the price of the items, StoreCost the sum of the costs of
+	// the visited stores.
+	Total     decimal.Decimal
+	StoreCost decimal.Decimal
+
+	// Feasible is false when the items cannot be bought within MaxStores.
+	Feasible bool
+	// Optimal is true when the search proved no cheaper basket exists.
+	Optimal bool
+}
+
+type state struct {
+	items  int
+	stores []string
+	cost   [][]int64 // cost[item][store], inf if not sold
+	offer  [][]int   // offer[item][store], index of the cheapest offer
+	fixed  []int64   // fixed[store], cost of the visit
+	scale  int32
+	k      int
+	limit  int
+	nodes  int
+
+	best      int64
+	bestSet   []int
+	bestCount int
+}
+
+// Solve returns the cheapest assignment of items to at most MaxStores
+// stores. Small problems are solved exactly by branch-and-bound over store
+// subsets, larger ones fall back to the best basket found by a greedy
+// heuristic and the part of the search that fit within Limit.
+func Solve(p *Problem) Solution {
+	s := newState(p)
+	if s.k <= 0 || len(s.stores) == 0 {
+		return Solution{}
+	}
+
+	s.greedy()
+	s.optimal()
+
+	if s.best == inf {
+		return Solution{}
+	}
+
+	sol := Solution{
+		Offers:   make([]int, s.items),
+		Feasible: true,
+		Optimal:  s.nodes <= s.limit,
+	}
+	used := make(map[int]bool)
+	for i := 0; i < s.items; i++ {
+		j := s.cheapest(i, s.bestSet)
+		o := s.offer[i][j]
+		sol.Offers[i] = o
+		sol.Total = sol.Total.Add(p.Offers[o].Price)
+		used[j] = true
+	}
+
+	var set []int
+	for j := range s.stores {
+		if used[j] {
+			set = append(set, j)
+		}
+	}
+	price, _ := s.price(set)
+	for n, j := range set {
+		v := Visit{
+			Store: s.stores[j],
+			Cost:  p.StoreCost[s.stores[j]],
+		}
+		others := append(append([]int(nil), set[:n]...), set[n+1:]...)
+		if c, missing := s.price(others); missing > 0 {
+			v.Required = true
+		} else {
+			v.Saving = decimal.New(c-price, -s.scale)
+		}
+		sol.StoreCost = sol.StoreCost.Add(v.Cost)
+		sol.Stores = append(sol.Stores, v)
+	}
+	return sol
+}
+
+func newState(p *Problem) *state {
+	s := &state{
+		items: len(p.Items),
+		k:     p.MaxStores,
+		limit: p.Limit,
+		best:  inf,
+	}
+	if s.limit <= 0 {
+		s.limit = DefaultLimit
+	}
+
+	// prices are compared as integers scaled to the finest precision used
+	for _, o := range p.Offers {
+		if e := -o.Price.Exponent(); e > s.scale {
+			s.scale = e
+		}
+	}
+	for _, c := range p.StoreCost {
+		if e := -c.Exponent(); e > s.scale {
+			s.scale = e
+		}
+	}
+	if s.scale > maxScale {
+		s.scale = maxScale
+	}
+	mul := decimal.New(1, s.scale)
+	scaled := func(d decimal.Decimal) int64 {
+		return d.Mul(mul).Round(0).IntPart()
+	}
+
+	items := make(map[string]int)
+	for i, id := range p.Items {
+		items[id] = i
+	}
+	stores := make(map[string]int)
+	for _, o := range p.Offers {
+		if _, ok := stores[o.Store]; !ok {
+			stores[o.Store] = len(s.stores)
+			s.stores = append(s.stores, o.Store)
+		}
+	}
+	if s.k > len(s.stores) {
+		s.k = len(s.stores)
+	}
+	s.fixed = make([]int64, len(s.stores))
+	for j, id := range s.stores {
+		s.fixed[j] = scaled(p.StoreCost[id])
+	}
+
+	s.cost = make([][]int64, s.items)
+	s.offer = make([][]int, s.items)
+	for i := range s.cost {
+		s.cost[i] = make([]int64, len(s.stores))
+		s.offer[i] = make([]int, len(s.stores))
+		for j := range s.cost[i] {
+			s.cost[i][j] = inf
+		}
+	}
+	for n, o := range p.Offers {
+		i, ok := items[o.Item]
+		if !ok {
+			continue
+		}
+		j := stores[o.Store]
+		c := scaled(o.Price)
+		if c < s.cost[i][j] {
+			s.cost[i][j] = c
+			s.offer[i][j] = n
+		}
+	}
+	return s
+}
+
+// cheapest returns the store in set with the lowest cost of item i.
+func (s *state) cheapest(i int, set []int) int {
+	best := set[0]
+	for _, j := range set[1:] {
+		if s.cost[i][j] < s.cost[i][best] {
+			best = j
+		}
+	}
+	return best
+}
+
+// eval returns the basket cost including the store costs when shopping in
+// set and the number of items that cannot be bought there.
+func (s *state) eval(set []int) (int64, int) {
+	total, missing := s.price(set)
+	for _, j := range set {
+		total += s.fixed[j]
+	}
+	return total, missing
+}
+
+// price returns the price of the items when shopping in set and the number
+// of items that cannot be bought there.
+func (s *state) price(set []int) (int64, int) {
+	var (
+		total   int64
+		missing int
+	)
+	for i := 0; i < s.items; i++ {
+		c := int64(inf)
+		for _, j := range set {
+			if s.cost[i][j] < c {
+				c = s.cost[i][j]
+			}
+		}
+		if c == inf {
+			missing++
+			continue
+		}
+		total += c
+	}
+	return total, missing
+}
+
+func (s *state) record(set []int, cost int64) {
+	if cost < s.best || cost == s.best && len(set) < s.bestCount {
+		s.best = cost
+		s.bestSet = append(s.bestSet[:0], set...)
+		s.bestCount = len(set)
+	}
+}
+
+// greedy adds the store that improves the basket the most until MaxStores
+// is reached, then swaps stores in and out while that lowers the cost.
+// The result is the initial upper bound for the exact search.
+func (s *state) greedy() {
+	var set []int
+	in := make([]bool, len(s.stores))
+
+	better := func(c int64, m int, bc int64, bm int) bool {
+		return m < bm || m == bm && c < bc
+	}
+
+	cost, missing := s.eval(set)
+	for len(set) < s.k {
+		pick, pc, pm := -1, cost, missing
+		for j := range s.stores {
+			if in[j] {
+				continue
+			}
+			if c, m := s.eval(append(set, j)); better(c, m, pc, pm) {
+				pick, pc, pm = j, c, m
+			}
+		}
+		if pick < 0 {
+			break
+		}
+		set = append(set, pick)
+		in[pick] = true
+		cost, missing = pc, pm
+	}
+
+	for improved := true; improved; {
+		improved = false
+		for n := range set {
+			for j := range s.stores {
+				if in[j] {
+					continue
+				}
+				old := set[n]
+				set[n] = j
+				if c, m := s.eval(set); better(c, m, cost, missing) {
+					in[old], in[j] = false, true
+					cost, missing = c, m
+					improved = true
+					continue
+				}
+				set[n] = old
+			}
+		}
+	}
+
+	if missing == 0 && len(set) > 0 {
+		s.record(set, cost)
+	}
+}
+
+// optimal runs branch-and-bound over store subsets of size at most
+// MaxStores. Stores are tried in order of how many items they sell the
+// cheapest, and a branch is cut when even buying every remaining item at
+// its lowest price among the stores still available cannot beat the best
+// basket.
+func (s *state) optimal() {
+	order := make([]int, len(s.stores))
+	wins := make([]int, len(s.stores))
+	for j := range order {
+		order[j] = j
+	}
+	for i := 0; i < s.items; i++ {
+		j := s.cheapest(i, order)
+		if s.cost[i][j] != inf {
+			wins[j]++
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return wins[order[a]] > wins[order[b]] })
+
+	// suffix[n][i] is the lowest cost of item i in stores order[n:]
+	suffix := make([][]int64, len(order)+1)
+	suffix[len(order)] = make([]int64, s.items)
+	for i := range suffix[len(order)] {
+		suffix[len(order)][i] = inf
+	}
+	for n := len(order) - 1; n >= 0; n-- {
+		suffix[n] = make([]int64, s.items)
+		for i := range suffix[n] {
+			suffix[n][i] = suffix[n+1][i]
+			if c := s.cost[i][order[n]]; c < suffix[n][i] {
+				suffix[n][i] = c
+			}
+		}
+	}
+
+	cur := make([]int64, s.items)
+	for i := range cur {
+		cur[i] = inf
+	}
+	s.search(order, suffix, 0, nil, cur)
+}
+
+func (s *state) search(order []int, suffix [][]int64, n int, set []int, cur []int64) {
+	s.nodes++
+	if s.nodes > s.limit {
+		return
+	}
+
+	var bound int64
+	for _, j := range set {
+		bound += s.fixed[j]
+	}
+	for i, c := range cur {
+		if suffix[n][i] < c {
+			c = suffix[n][i]
+		}
+		if c == inf {
+			return
+		}
+		bound += c
+	}
+	if bound > s.best || bound == s.best && len(set) >= s.bestCount {
+		return
+	}
+	if n == len(order) || len(set) == s.k {
+		return
+	}
+
+	j := order[n]
+	next := make([]int64, len(cur))
+	var (
+		total   = s.fixed[j]
+		missing bool
+	)
+	for _, m := range set {
+		total += s.fixed[m]
+	}
+	for i, c := range cur {
+		if s.cost[i][j] < c {
+			c = s.cost[i][j]
+		}
+		next[i] = c
+		if c == inf {
+			missing = true
+		} else {
+			total += c
+		}
+	}
+	set = append(set, j)
+	if !missing {
+		s.record(set, total)
+	}
+	s.search(order, suffix, n+1, set, next)
+	s.search(order, suffix, n+1, set[:len(set)-1], cur)
+}
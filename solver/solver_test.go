@@ -0,0 +1,231 @@
+package solver
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func price(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// brute returns the lowest price of the items with the costs of the stores
+// visited among every set of at most MaxStores stores, ok is false when no
+// such set sells every item.
+func brute(p *Problem) (best decimal.Decimal, ok bool) {
+	var stores []string
+	seen := make(map[string]bool)
+	for _, o := range p.Offers {
+		if !seen[o.Store] {
+			seen[o.Store] = true
+			stores = append(stores, o.Store)
+		}
+	}
+	for mask := 1; mask < 1<<len(stores); mask++ {
+		var (
+			in    = make(map[string]bool)
+			total decimal.Decimal
+		)
+		for j, st := range stores {
+			if mask&(1<<j) != 0 {
+				in[st] = true
+				total = total.Add(p.StoreCost[st])
+			}
+		}
+		if len(in) > p.MaxStores {
+			continue
+		}
+		all := true
+		for _, item := range p.Items {
+			var (
+				low   decimal.Decimal
+				found bool
+			)
+			for _, o := range p.Offers {
+				if o.Item == item && in[o.Store] && (!found || o.Price.Cmp(low) < 0) {
+					low, found = o.Price, true
+				}
+			}
+			if !found {
+				all = false
+				break
+			}
+			total = total.Add(low)
+		}
+		if all && (!ok || total.Cmp(best) < 0) {
+			best, ok = total, true
+		}
+	}
+	return best, ok
+}
+
+// random returns a problem of items sold by some of the stores at prices up
+// to 10.00, visiting a store costs up to 2.00.
+func random(r *rand.Rand, items, stores int) *Problem {
+	p := &Problem{
+		MaxStores: 1 + r.Intn(3),
+		StoreCost: make(map[string]decimal.Decimal),
+	}
+	for i := 0; i < items; i++ {
+		p.Items = append(p.Items, fmt.Sprint("item", i))
+	}
+	for j := 0; j < stores; j++ {
+		st := fmt.Sprint("store", j)
+		p.StoreCost[st] = decimal.New(int64(r.Intn(200)), -2)
+		for _, item := range p.Items {
+			if r.Intn(4) > 0 {
+				p.Offers = append(p.Offers, Offer{Item: item, Store: st, Price: decimal.New(int64(1+r.Intn(1000)), -2)})
+			}
+		}
+	}
+	return p
+}
+
+// check reports where sol is not a basket of p.
+func check(t *testing.T, name string, p *Problem, sol Solution) {
+	t.Helper()
+	if len(sol.Stores) > p.MaxStores {
+		t.Errorf("%s: visits %d stores, more than %d", name, len(sol.Stores), p.MaxStores)
+	}
+	visited := make(map[string]bool)
+	var cost decimal.Decimal
+	for _, v := range sol.Stores {
+		visited[v.Store] = true
+		cost = cost.Add(v.Cost)
+	}
+	if cost.Cmp(sol.StoreCost) != 0 {
+		t.Errorf("%s: store cost %s, want the sum of the visits %s", name, sol.StoreCost, cost)
+	}
+	var total decimal.Decimal
+	for i, o := range sol.Offers {
+		offer := p.Offers[o]
+		if offer.Item != p.Items[i] || !visited[offer.Store] {
+			t.Errorf("%s: item %s bought by offer %+v", name, p.Items[i], offer)
+		}
+		total = total.Add(offer.Price)
+	}
+	if total.Cmp(sol.Total) != 0 {
+		t.Errorf("%s: total %s, want the sum of the offers %s", name, sol.Total, total)
+	}
+}
+
+func TestSolveBrute(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 500; n++ {
+		p := random(r, 1+r.Intn(8), 1+r.Intn(7))
+		name := fmt.Sprintf("problem %d", n)
+		sol := Solve(p)
+		want, ok := brute(p)
+		if sol.Feasible != ok {
+			t.Errorf("%s: feasible %t, want %t", name, sol.Feasible, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		check(t, name, p, sol)
+		if !sol.Optimal {
+			t.Errorf("%s: not optimal within the default limit", name)
+		}
+		if got := sol.Total.Add(sol.StoreCost); got.Cmp(want) != 0 {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestSolve(t *testing.T) {
+	offers := []Offer{
+		{"milk", "a", price("3")}, {"bread", "a", price("4")},
+		{"milk", "b", price("2")}, {"bread", "b", price("5")},
+	}
+	cases := []struct {
+		name     string
+		problem  Problem
+		feasible bool
+		stores   string
+		total    string
+	}{
+		{"one store", Problem{Items: []string{"milk", "bread"}, Offers: offers, MaxStores: 1},
+			true, "[a]", "7"},
+		{"two stores", Problem{Items: []string{"milk", "bread"}, Offers: offers, MaxStores: 2},
+			true, "[a b]", "6"},
+		{"store cost", Problem{Items: []string{"milk", "bread"}, Offers: offers, MaxStores: 2,
+			StoreCost: map[string]decimal.Decimal{"a": price("1.5"), "b": price("2")}},
+			true, "[a]", "7"},
+		// a alone and a with b both cost 8, b alone 8.5
+		{"tie takes fewer stores", Problem{Items: []string{"milk", "bread"}, Offers: offers, MaxStores: 2,
+			StoreCost: map[string]decimal.Decimal{"a": price("1"), "b": price("1.5")}},
+			true, "[a]", "7"},
+		{"not sold", Problem{Items: []string{"milk", "bread"}, Offers: offers[:1], MaxStores: 2},
+			false, "[]", "0"},
+		{"too many stores", Problem{Items: []string{"milk", "bread"}, Offers: []Offer{offers[1], offers[2]}, MaxStores: 1},
+			false, "[]", "0"},
+		{"no store", Problem{Items: []string{"milk"}, Offers: offers, MaxStores: 0},
+			false, "[]", "0"},
+	}
+	for _, tc := range cases {
+		sol := Solve(&tc.problem)
+		var stores []string
+		for _, v := range sol.Stores {
+			stores = append(stores, v.Store)
+		}
+		if sol.Feasible != tc.feasible || fmt.Sprint(stores) != tc.stores || sol.Total.Cmp(price(tc.total)) != 0 {
+			t.Errorf("%s: got feasible %t in %v for %s, want %t in %s for %s",
+				tc.name, sol.Feasible, stores, sol.Total, tc.feasible, tc.stores, tc.total)
+		}
+		if sol.Feasible {
+			check(t, tc.name, &tc.problem, sol)
+		}
+	}
+}
+
+func TestSolveSaving(t *testing.T) {
+	p := &Problem{
+		Items: []string{"milk", "bread", "salt"},
+		Offers: []Offer{
+			{"milk", "a", price("3")}, {"bread", "a", price("4")},
+			{"milk", "b", price("2")}, {"bread", "b", price("5")}, {"salt", "b", price("1")},
+		},
+		MaxStores: 2,
+	}
+	sol := Solve(p)
+	got := make(map[string]string)
+	for _, v := range sol.Stores {
+		got[v.Store] = fmt.Sprint(v.Saving, " ", v.Required)
+	}
+	// bread costs 1 more without a, only b sells salt
+	want := map[string]string{"a": "1 false", "b": "0 true"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got savings %v, want %v", got, want)
+	}
+}
+
+func TestSolveLimit(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for n := 0; n < 100; n++ {
+		p := random(r, 8, 12)
+		p.MaxStores = 3
+		p.Limit = 1
+		name := fmt.Sprintf("problem %d", n)
+		sol := Solve(p)
+		if sol.Optimal {
+			t.Errorf("%s: optimal after %d node", name, p.Limit)
+		}
+		want, ok := brute(p)
+		if !sol.Feasible {
+			// the greedy basket may miss the feasible sets
+			continue
+		}
+		check(t, name, p, sol)
+		if got := sol.Total.Add(sol.StoreCost); !ok || got.Cmp(want) < 0 {
+			t.Errorf("%s: got %s, cheaper than the optimum %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package sql
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/lib/pq"
+)
+
+var _ bp.AdminService = &AdminService{}
+
+type AdminService struct {
+	db *sql.DB
+}
+
+// nullID returns the value of id for a nullable uuid column.
+func nullID(id bp.ID) interface{} {
+	if id.Null() {
+		return nil
+	}
+	return id.String()
+}
+
+// catalogError translates constraint violations into bp.ConflictError.
+func catalogError(err error) error {
+	if e, ok := err.(*pq.Error); ok {
+		switch e.Code.Name() {
+		case "foreign_key_violation":
+			return bp.ConflictError("referenced item does not exist or is still in use")
+		case "unique_violation":
+			return bp.ConflictError("item already exists")
+		}
+	}
+	return err
+}
+
+// affected returns bp.ErrNotFound when res changed no rows.
+func affected(res sql.Result, err error) error {
+	if err != nil {
+		return catalogError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return bp.ErrNotFound
+	}
+	return nil
+}
+
+// refresh rebuilds the product search index once a change of the catalog
+// succeeded. The index holds the names of products, of their brands and of
+// their categories only, so it is rebuilt here and by Client.Load, the
+// only writers of those, and not by price imports. Catalogs changed outside
+// of the service need REFRESH MATERIALIZED VIEW product_search.
+//
+// The change is committed by then, a failed rebuild is logged and not
+// returned, the index catches up with the next change that rebuilds it.
+func (s AdminService) refresh(err error) error {
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`REFRESH MATERIALIZED VIEW CONCURRENTLY product_search`); err != nil {
+		log.Println("refresh product_search:", err)
+	}
+	return nil
+}
+
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func exists(q queryer, query string, args ...interface{}) (bool, error) {
+	var ok bool
+	err := q.QueryRow(`SELECT EXISTS (`+query+`)`, args...).Scan(&ok)
+	return ok, err
+}
+
+// checkCategory verifies id is a category, nil is the root.
+func checkCategory(q queryer, id bp.ID) error {
+	if id.Null() {
+		return nil
+	}
+	ok, err := exists(q, `SELECT 1 FROM product WHERE id_product = $1 AND price_description = ''`, id.String())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return bp.ConflictError("parent category does not exist")
+	}
+	return nil
+}
+
+// checkBrand verifies the brand with id exists.
+func checkBrand(q queryer, id bp.ID) error {
+	ok, err := exists(q, `SELECT 1 FROM brand WHERE id_brand = $1`, id.String())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return bp.ConflictError("brand does not exist")
+	}
+	return nil
+}
+
+// checkChildren refuses to delete a product with other products below it.
+func checkChildren(q queryer, id bp.ID) error {
+	ok, err := exists(q, `SELECT 1 FROM product WHERE id_parent_product = $1`, id.String())
+	if err != nil {
+		return err
+	}
+	if ok {
+		return bp.ConflictError("category has subcategories or products")
+	}
+	return nil
+}
+
+func (s AdminService) CreateCategory(c *bp.Category) error {
+	if err := checkCategory(s.db, c.IDParent); err != nil {
+		return err
+	}
+	c.ID = bp.RandID()
+	c.Subcategories = nil
+	_, err := s.db.Exec(`
+	INSERT INTO product (id_product, product_name, id_parent_product, price_description)
+	VALUES ($1, $2, $3, '')`, c.ID.String(), c.Name, nullID(c.IDParent))
+	return s.refresh(catalogError(err))
+}
+
+func (s AdminService) UpdateCategory(c *bp.Category) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkCategory(tx, c.IDParent); err != nil {
+		return err
+	}
+	if !c.IDParent.Null() {
+		// walk up from the new parent, the category must not be met
+		cycle, err := exists(tx, `
+		WITH RECURSIVE up (id_product, id_parent_product) AS (
+			SELECT id_product, id_parent_product FROM product WHERE id_product = $1
+			UNION
+			SELECT p.id_product, p.id_parent_product
+			FROM product p, up
+			WHERE p.id_product = up.id_parent_product
+		)
+		SELECT 1 FROM up WHERE id_product = $2`, c.IDParent.String(), c.ID.String())
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return bp.ConflictError("category can not be moved below itself")
+		}
+	}
+
+	c.Subcategories = nil
+	err = affected(tx.Exec(`
+	UPDATE product SET product_name = $2, id_parent_product = $3
+	WHERE id_product = $1 AND price_description = ''`, c.ID.String(), c.Name, nullID(c.IDParent)))
+	if err != nil {
+		return err
+	}
+	return s.refresh(tx.Commit())
+}
+
+func (s AdminService) DeleteCategory(id bp.ID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkChildren(tx, id); err != nil {
+		return err
+	}
+	err = affected(tx.Exec(`DELETE FROM product WHERE id_product = $1 AND price_description = ''`, id.String()))
+	if err != nil {
+		return err
+	}
+	return s.refresh(tx.Commit())
+}
+
+func (s AdminService) CreateProduct(p *bp.Product) error {
+	if err := checkCategory(s.db, p.IDCategory); err != nil {
+		return err
+	}
+	if err := checkBrand(s.db, p.Brand.ID); err != nil {
+		return err
+	}
+	p.ID = bp.RandID()
+	_, err := s.db.Exec(`
+	INSERT INTO product (id_product, product_name, id_parent_product, id_brand,
+	price_description, weight, volume, decimal_possibility)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		p.ID.String(), p.Name, p.IDCategory.String(), p.Brand.ID.String(), p.PriceDescription.String,
+		p.Weight.NullInt64, p.Volume.NullInt64, p.DecimalPossibility.NullBool)
+	return s.refresh(catalogError(err))
+}
+
+func (s AdminService) UpdateProduct(p *bp.Product) error {
+	if err := checkCategory(s.db, p.IDCategory); err != nil {
+		return err
+	}
+	if err := checkBrand(s.db, p.Brand.ID); err != nil {
+		return err
+	}
+	return s.refresh(affected(s.db.Exec(`
+	UPDATE product SET product_name = $2, id_parent_product = $3, id_brand = $4,
+	price_description = $5, weight = $6, volume = $7, decimal_possibility = $8
+	WHERE id_product = $1 AND price_description <> ''`,
+		p.ID.String(), p.Name, p.IDCategory.String(), p.Brand.ID.String(), p.PriceDescription.String,
+		p.Weight.NullInt64, p.Volume.NullInt64, p.DecimalPossibility.NullBool)))
+}
+
+func (s AdminService) DeleteProduct(id bp.ID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkChildren(tx, id); err != nil {
+		return err
+	}
+	err = affected(tx.Exec(`DELETE FROM product WHERE id_product = $1 AND price_description <> ''`, id.String()))
+	if err != nil {
+		return err
+	}
+	return s.refresh(tx.Commit())
+}
+
+func (s AdminService) CreateBrand(b *bp.Brand) error {
+	b.ID = bp.RandID()
+	_, err := s.db.Exec(`INSERT INTO brand (id_brand, brand_name) VALUES ($1, $2)`, b.ID.String(), b.Name)
+	return s.refresh(catalogError(err))
+}
+
+func (s AdminService) UpdateBrand(b *bp.Brand) error {
+	return s.refresh(affected(s.db.Exec(`UPDATE brand SET brand_name = $2 WHERE id_brand = $1`, b.ID.String(), b.Name)))
+}
+
+func (s AdminService) DeleteBrand(id bp.ID) error {
+	used, err := exists(s.db, `SELECT 1 FROM product WHERE id_brand = $1`, id.String())
+	if err != nil {
+		return err
+	}
+	if used {
+		return bp.ConflictError("brand is used by products")
+	}
+	return s.refresh(affected(s.db.Exec(`DELETE FROM brand WHERE id_brand = $1`, id.String())))
+}
+
+func (s AdminService) CreateChainstore(c *bp.Chainstore) error {
+	c.ID = bp.RandID()
+	_, err := s.db.Exec(`INSERT INTO chain_store (id_chain_store, chain_store_name) VALUES ($1, $2)`,
+		c.ID.String(), c.Name)
+	return catalogError(err)
+}
+
+func (s AdminService) UpdateChainstore(c *bp.Chainstore) error {
+	return affected(s.db.Exec(`UPDATE chain_store SET chain_store_name = $2 WHERE id_chain_store = $1`,
+		c.ID.String(), c.Name))
+}
+
+func (s AdminService) DeleteChainstore(id bp.ID) error {
+	used, err := exists(s.db, `SELECT 1 FROM store WHERE id_chain_store = $1`, id.String())
+	if err != nil {
+		return err
+	}
+	if used {
+		return bp.ConflictError("chain store still has stores")
+	}
+	return affected(s.db.Exec(`DELETE FROM chain_store WHERE id_chain_store = $1`, id.String()))
+}
+
+func (s AdminService) CreateStore(st *bp.Store) error {
+	st.ID = bp.RandID()
+	_, err := s.db.Exec(`
+	INSERT INTO store (id_store, id_chain_store, store_name, city, street_and_nr,
+	district, region, latitude, longitude)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		st.ID.String(), st.IDChainStore.String(), st.Name.NullString, st.City.NullString,
+		st.Street.NullString, st.District.NullString, st.Region.NullString,
+		st.Lat.String(), st.Lng.String())
+	return catalogError(err)
+}
+
+func (s AdminService) UpdateStore(st *bp.Store) error {
+	return affected(s.db.Exec(`
+	UPDATE store SET id_chain_store = $2, store_name = $3, city = $4, street_and_nr = $5,
+	district = $6, region = $7, latitude = $8, longitude = $9
+	WHERE id_store = $1`,
+		st.ID.String(), st.IDChainStore.String(), st.Name.NullString, st.City.NullString,
+		st.Street.NullString, st.District.NullString, st.Region.NullString,
+		st.Lat.String(), st.Lng.String()))
+}
+
+func (s AdminService) DeleteStore(id bp.ID) error {
+	return affected(s.db.Exec(`DELETE FROM store WHERE id_store = $1`, id.String()))
+}
+
+// promotionArgs returns the columns of p in the order of the promotion
+// table, valid from now unless set.
+func promotionArgs(p *bp.Promotion) []interface{} {
+	if p.ValidFrom.IsZero() {
+		p.ValidFrom = time.Now()
+	}
+	var price sql.NullString
+	if p.Price != nil {
+		price = sql.NullString{String: p.Price.String(), Valid: true}
+	}
+	return []interface{}{p.ID.String(), p.IDProduct.String(), p.IDChainStore.String(), string(p.Kind),
+		price, p.Buy, p.Pay, p.Percent, p.LoyaltyCard, p.ValidFrom, p.ValidTo}
+}
+
+func (s AdminService) CreatePromotion(p *bp.Promotion) error {
+	p.ID = bp.RandID()
+	_, err := s.db.Exec(`
+	INSERT INTO promotion (id_promotion, id_product, id_chain_store, kind,
+	price, buy, pay, percent, loyalty_card, valid_from, valid_to)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`, promotionArgs(p)...)
+	return catalogError(err)
+}
+
+func (s AdminService) UpdatePromotion(p *bp.Promotion) error {
+	return affected(s.db.Exec(`
+	UPDATE promotion SET id_product = $2, id_chain_store = $3, kind = $4,
+	price = $5, buy = $6, pay = $7, percent = $8, loyalty_card = $9, valid_from = $10, valid_to = $11
+	WHERE id_promotion = $1`, promotionArgs(p)...))
+}
+
+func (s AdminService) DeletePromotion(id bp.ID) error {
+	return affected(s.db.Exec(`DELETE FROM promotion WHERE id_promotion = $1`, id.String()))
+}
@@ -0,0 +1,270 @@
+package sql
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/lib/pq"
+)
+
+var _ bp.AlertService = &AlertService{}
+
+type AlertService struct {
+	db *sql.DB
+}
+
+// alertMatch is the condition under which a product_prices row pp reaches
+// the target of a price_alert row a.
+const alertMatch = `
+	pp.id_product = a.id_product
+	AND pp.unit_price <= a.target_price
+	AND (cardinality(a.id_chain_stores) = 0 OR pp.id_chain_store = ANY(a.id_chain_stores))
+`
+
+const alertColumns = `a.id_alert, a.id_product, a.id_chain_stores, a.target_price, a.subscriber, a.created_at`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAlert(row scanner, a *bp.Alert) error {
+	var cs pq.StringArray
+	err := row.Scan(&a.ID, &a.IDProduct, &cs, &a.TargetPrice, &a.Subscriber, &a.Created)
+	if err != nil {
+		return err
+	}
+	a.IDChainStores, err = parseIDs(cs)
+	return err
+}
+
+func parseIDs(hex []string) ([]bp.ID, error) {
+	ids := make([]bp.ID, 0, len(hex))
+	for _, h := range hex {
+		id, err := bp.NewID(h)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, *id)
+	}
+	return ids, nil
+}
+
+func idStrings(ids []bp.ID) []string {
+	vals := make([]string, len(ids))
+	for i, id := range ids {
+		vals[i] = id.String()
+	}
+	return vals
+}
+
+func (s AlertService) Alerts(subscriber string) ([]bp.Alert, error) {
+	query := `SELECT ` + alertColumns + ` FROM price_alert a
+	WHERE a.subscriber = $1
+	ORDER BY a.created_at`
+
+	rows, err := s.db.Query(query, subscriber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vals := make([]bp.Alert, 0, 8)
+	for rows.Next() {
+		var a bp.Alert
+		if err := scanAlert(rows, &a); err != nil {
+			return nil, err
+		}
+		vals = append(vals, a)
+	}
+
+	return vals, rows.Err()
+}
+
+func (s AlertService) Alert(id bp.ID) (bp.Alert, error) {
+	query := `SELECT ` + alertColumns + ` FROM price_alert a WHERE a.id_alert = $1`
+
+	var a bp.Alert
+	err := scanAlert(s.db.QueryRow(query, id.String()), &a)
+	if err == sql.ErrNoRows {
+		return a, bp.ErrNotFound
+	}
+	return a, err
+}
+
+// chainStores returns bp.ConflictError when some of ids are not chain
+// stores, the array of an alert can not reference them.
+func (s AlertService) chainStores(ids []bp.ID) error {
+	var n int
+	err := s.db.QueryRow(`
+	SELECT count(*) FROM unnest($1::uuid[]) c
+	WHERE NOT EXISTS (SELECT 1 FROM chain_store WHERE id_chain_store = c)`,
+		pq.Array(idStrings(ids))).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return bp.ConflictError("chain store does not exist")
+	}
+	return nil
+}
+
+func (s AlertService) CreateAlert(a *bp.Alert) error {
+	if err := s.chainStores(a.IDChainStores); err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO price_alert (id_alert, id_product, id_chain_stores, target_price, subscriber)
+	VALUES ($1, $2, $3::uuid[], $4, $5)
+	RETURNING created_at`
+
+	a.ID = bp.RandID()
+	err := s.db.QueryRow(query, a.ID.String(), a.IDProduct.String(),
+		pq.Array(idStrings(a.IDChainStores)), a.TargetPrice.String(), a.Subscriber).Scan(&a.Created)
+	return catalogError(err)
+}
+
+func (s AlertService) UpdateAlert(a *bp.Alert) error {
+	if err := s.chainStores(a.IDChainStores); err != nil {
+		return err
+	}
+	// a changed alert is armed again
+	query := `
+	UPDATE price_alert
+	SET id_product = $2, id_chain_stores = $3::uuid[], target_price = $4, subscriber = $5, triggered = false
+	WHERE id_alert = $1
+	RETURNING created_at`
+
+	err := s.db.QueryRow(query, a.ID.String(), a.IDProduct.String(),
+		pq.Array(idStrings(a.IDChainStores)), a.TargetPrice.String(), a.Subscriber).Scan(&a.Created)
+	if err == sql.ErrNoRows {
+		return bp.ErrNotFound
+	}
+	return catalogError(err)
+}
+
+func (s AlertService) DeleteAlert(id bp.ID) error {
+	res, err := s.db.Exec(`DELETE FROM price_alert WHERE id_alert = $1`, id.String())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return bp.ErrNotFound
+	}
+	return nil
+}
+
+// alertLock is the advisory lock held while the alerts are evaluated, so
+// servers evaluating them at once do not trigger an alert twice.
+const alertLock = 4243
+
+// alertLease is how long a server has to deliver the pending alerts it
+// claimed before other servers may claim them again.
+const alertLease = 5 * time.Minute
+
+// EvaluateAlerts triggers every armed alert with a matching price, writing
+// the lowest such price to the outbox. Triggered alerts are armed again
+// once no price reaches their target anymore, so an alert fires once per
+// price drop.
+func (s AlertService) EvaluateAlerts() (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, alertLock); err != nil {
+		return 0, err
+	}
+
+	rearm := `
+	UPDATE price_alert a SET triggered = false
+	WHERE a.triggered AND NOT EXISTS (
+		SELECT 1 FROM product_prices pp WHERE ` + alertMatch + `
+	)`
+	if _, err := tx.Exec(rearm); err != nil {
+		return 0, err
+	}
+
+	trigger := `
+	WITH hits AS (
+		SELECT DISTINCT ON (a.id_alert) a.id_alert, pp.id_chain_store, pp.unit_price
+		FROM price_alert a
+		JOIN product_prices pp ON ` + alertMatch + `
+		WHERE NOT a.triggered
+		ORDER BY a.id_alert, pp.unit_price
+	), fired AS (
+		UPDATE price_alert a SET triggered = true
+		FROM hits h
+		WHERE a.id_alert = h.id_alert
+	)
+	INSERT INTO alert_outbox (id_alert, id_chain_store, unit_price)
+	SELECT h.id_alert, h.id_chain_store, h.unit_price FROM hits h`
+	res, err := tx.Exec(trigger)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), tx.Commit()
+}
+
+// PendingAlerts claims the undelivered alerts for alertLease, rows locked
+// or leased by other servers are skipped.
+func (s AlertService) PendingAlerts(n int) ([]bp.TriggeredAlert, error) {
+	query := `
+	WITH claimed AS (
+		SELECT id_outbox FROM alert_outbox
+		WHERE delivered_at IS NULL AND (leased_until IS NULL OR leased_until < now())
+		ORDER BY id_outbox
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	), leased AS (
+		UPDATE alert_outbox o SET leased_until = now() + $2::float8 * interval '1 second', attempts = o.attempts + 1
+		FROM claimed c
+		WHERE o.id_outbox = c.id_outbox
+		RETURNING o.*
+	)
+	SELECT o.id_outbox, p.product_name, o.id_chain_store, cs.chain_store_name,
+	o.unit_price, o.created_at, ` + alertColumns + `
+	FROM leased o
+	JOIN price_alert a ON a.id_alert = o.id_alert
+	JOIN product p ON p.id_product = a.id_product
+	JOIN chain_store cs ON cs.id_chain_store = o.id_chain_store
+	ORDER BY o.id_outbox`
+
+	rows, err := s.db.Query(query, n, alertLease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vals := make([]bp.TriggeredAlert, 0, n)
+	for rows.Next() {
+		var (
+			t  bp.TriggeredAlert
+			cs pq.StringArray
+			a  = &t.Alert
+		)
+		if err := rows.Scan(&t.ID, &t.Product, &t.IDChainStore, &t.ChainStore, &t.Price, &t.Triggered,
+			&a.ID, &a.IDProduct, &cs, &a.TargetPrice, &a.Subscriber, &a.Created); err != nil {
+			return nil, err
+		}
+		if a.IDChainStores, err = parseIDs(cs); err != nil {
+			return nil, err
+		}
+		vals = append(vals, t)
+	}
+
+	return vals, rows.Err()
+}
+
+func (s AlertService) MarkDelivered(id int64) error {
+	_, err := s.db.Exec(`UPDATE alert_outbox SET delivered_at = now() WHERE id_outbox = $1`, id)
+	return err
+}
@@ -8,22 +8,56 @@ import (
 
 // Client represents client to the sql database
 type Client struct {
-	db *sql.DB
+	db   *sql.DB
+	stmt *statements
 
 	// Path to postgres database
 	Path string
 }
 
-func (c *Client) Open() error {
+// Connect opens the connection pool without touching the schema.
+func (c *Client) Connect() error {
 	db, err := sql.Open("postgres", c.Path)
 	if err != nil {
 		return err
 	}
 	c.db = db
-	_, err = db.Query("CREATE EXTENSION IF NOT EXISTS unaccent")
+	return nil
+}
+
+// Open connects to the database and applies the pending migrations.
+func (c *Client) Open() error {
+	if err := c.Connect(); err != nil {
+		return err
+	}
+	if _, err := c.MigrateUp(); err != nil {
+		return err
+	}
+	var err error
+	c.stmt, err = prepare(c.db)
 	return err
 }
 
 func (c *Client) Service() *Service {
-	return &Service{db: c.db}
+	return &Service{db: c.db, stmt: c.stmt}
+}
+
+func (c *Client) AlertService() *AlertService {
+	return &AlertService{db: c.db}
+}
+
+func (c *Client) ImportService() *ImportService {
+	return &ImportService{db: c.db}
+}
+
+func (c *Client) AdminService() *AdminService {
+	return &AdminService{db: c.db}
+}
+
+func (c *Client) KeyService() *KeyService {
+	return &KeyService{db: c.db}
+}
+
+func (c *Client) UserService() *UserService {
+	return &UserService{db: c.db}
 }
@@ -0,0 +1,169 @@
+package sql
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/lib/pq"
+)
+
+var _ bp.ImportService = &ImportService{}
+
+type ImportService struct {
+	db *sql.DB
+}
+
+// importChecks finds the rows of price_import not matching the catalog.
+const importChecks = `
+SELECT i.row_nr, CASE
+	WHEN cs.id_chain_store IS NULL THEN 'unknown chain store'
+	WHEN p.id_product IS NULL THEN 'unknown product'
+	WHEN b.id_brand IS NULL THEN 'unknown brand'
+	WHEN p.price_description = '' THEN 'product is a category'
+	WHEN p.id_brand <> i.id_brand THEN 'brand does not match the product'
+	WHEN i.price_description <> '' AND i.price_description <> p.price_description
+		THEN 'price description does not match the product'
+	WHEN i.unit_price <= 0 THEN 'price must be positive'
+	WHEN i.id_store IS NOT NULL AND s.id_store IS NULL THEN 'unknown store'
+	WHEN s.id_chain_store <> i.id_chain_store THEN 'store is not of the chain store'
+END error
+FROM price_import i
+LEFT JOIN chain_store cs ON cs.id_chain_store = i.id_chain_store
+LEFT JOIN product p ON p.id_product = i.id_product
+LEFT JOIN brand b ON b.id_brand = i.id_brand
+LEFT JOIN store s ON s.id_store = i.id_store
+`
+
+// ImportPrices copies the rows into a temporary table, drops the ones not
+// matching the catalog, appends the rest to the price history and updates
+// the current prices with the latest observations, the chain wide ones and
+// the overrides of narrower scopes. Only prices change, the search index of
+// the catalog stays valid.
+func (s ImportService) ImportPrices(rows []bp.PriceRow, source string) (bp.ImportReport, error) {
+	report := bp.ImportReport{Rows: len(rows)}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+	CREATE TEMP TABLE price_import (
+		row_nr int,
+		id_chain_store uuid,
+		id_product uuid,
+		id_brand uuid,
+		unit_price numeric(10, 2),
+		price_description text,
+		observed_at timestamptz,
+		id_store uuid,
+		region text,
+		district text
+	) ON COMMIT DROP`); err != nil {
+		return report, err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("price_import", "row_nr", "id_chain_store", "id_product",
+		"id_brand", "unit_price", "price_description", "observed_at", "id_store", "region", "district"))
+	if err != nil {
+		return report, err
+	}
+	now := time.Now()
+	for _, r := range rows {
+		observed := r.Observed
+		if observed.IsZero() {
+			observed = now
+		}
+		var store interface{}
+		if r.IDStore != nil {
+			store = r.IDStore.String()
+		}
+		if _, err := stmt.Exec(r.Row, r.IDChainStore.String(), r.IDProduct.String(),
+			r.IDBrand.String(), r.Price.String(), r.PriceDescription, observed,
+			store, r.Region, r.District); err != nil {
+			stmt.Close()
+			return report, err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return report, err
+	}
+	if err := stmt.Close(); err != nil {
+		return report, err
+	}
+
+	checks, err := tx.Query(`SELECT * FROM (` + importChecks + `) c WHERE c.error IS NOT NULL`)
+	if err != nil {
+		return report, err
+	}
+	defer checks.Close()
+
+	var rejected []int64
+	for checks.Next() {
+		var e bp.RowError
+		if err := checks.Scan(&e.Row, &e.Error); err != nil {
+			return report, err
+		}
+		rejected = append(rejected, int64(e.Row))
+		report.Errors = append(report.Errors, e)
+	}
+	if err := checks.Err(); err != nil {
+		return report, err
+	}
+	checks.Close()
+	sort.Slice(report.Errors, func(i, j int) bool { return report.Errors[i].Row < report.Errors[j].Row })
+
+	if _, err := tx.Exec(`DELETE FROM price_import WHERE row_nr = ANY($1)`, pq.Array(rejected)); err != nil {
+		return report, err
+	}
+
+	res, err := tx.Exec(`
+	INSERT INTO price_history (id_product, id_chain_store, unit_price, observed_at, source,
+	id_store, region, district)
+	SELECT i.id_product, i.id_chain_store, i.unit_price, i.observed_at, $1,
+	i.id_store, i.region, i.district
+	FROM price_import i`, source)
+	if err != nil {
+		return report, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return report, err
+	}
+
+	if _, err := tx.Exec(`
+	INSERT INTO price (id_product, id_chain_store, unit_price, observed_at)
+	SELECT DISTINCT ON (i.id_product, i.id_chain_store)
+	i.id_product, i.id_chain_store, i.unit_price, i.observed_at
+	FROM price_import i
+	WHERE i.id_store IS NULL AND i.region = '' AND i.district = ''
+	ORDER BY i.id_product, i.id_chain_store, i.observed_at DESC
+	ON CONFLICT (id_product, id_chain_store) DO UPDATE
+	SET unit_price = EXCLUDED.unit_price, observed_at = EXCLUDED.observed_at
+	WHERE price.observed_at <= EXCLUDED.observed_at`); err != nil {
+		return report, err
+	}
+
+	if _, err := tx.Exec(`
+	INSERT INTO price_override (id_product, id_chain_store, id_store, region, district, unit_price, observed_at)
+	SELECT DISTINCT ON (i.id_product, i.id_chain_store, i.id_store, i.region, i.district)
+	i.id_product, i.id_chain_store, i.id_store, i.region, i.district, i.unit_price, i.observed_at
+	FROM price_import i
+	WHERE i.id_store IS NOT NULL OR i.region <> '' OR i.district <> ''
+	ORDER BY i.id_product, i.id_chain_store, i.id_store, i.region, i.district, i.observed_at DESC
+	ON CONFLICT (id_product, id_chain_store, coalesce(id_store, '00000000-0000-0000-0000-000000000000'), region, district)
+	DO UPDATE SET unit_price = EXCLUDED.unit_price, observed_at = EXCLUDED.observed_at
+	WHERE price_override.observed_at <= EXCLUDED.observed_at`); err != nil {
+		return report, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return report, err
+	}
+	report.Imported = int(n)
+	return report, nil
+}
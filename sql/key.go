@@ -0,0 +1,134 @@
+package sql
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/lib/pq"
+)
+
+var _ bp.KeyService = &KeyService{}
+
+type KeyService struct {
+	db *sql.DB
+}
+
+// newSecret returns a random secret and the hash it is stored as. Secrets
+// are random enough for a plain SHA-256 to protect them.
+func newSecret(prefix string) (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret := prefix + hex.EncodeToString(b)
+	return secret, hashSecret(secret), nil
+}
+
+func hashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+const keyPrefix = "bp_"
+
+const keyColumns = `k.id_key, k.name, k.scopes, k.created_at, k.revoked_at`
+
+func scanKey(row scanner, k *bp.APIKey) error {
+	var (
+		scopes  pq.StringArray
+		revoked pq.NullTime
+	)
+	if err := row.Scan(&k.ID, &k.Name, &scopes, &k.Created, &revoked); err != nil {
+		return err
+	}
+	k.Scopes = make([]bp.Scope, len(scopes))
+	for i, s := range scopes {
+		k.Scopes[i] = bp.Scope(s)
+	}
+	if revoked.Valid {
+		k.Revoked = &revoked.Time
+	}
+	return nil
+}
+
+func (s KeyService) Keys() ([]bp.APIKey, error) {
+	rows, err := s.db.Query(`SELECT ` + keyColumns + ` FROM api_key k ORDER BY k.created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vals := make([]bp.APIKey, 0, 8)
+	for rows.Next() {
+		var k bp.APIKey
+		if err := scanKey(rows, &k); err != nil {
+			return nil, err
+		}
+		vals = append(vals, k)
+	}
+
+	return vals, rows.Err()
+}
+
+func (s KeyService) CreateKey(k *bp.APIKey) error {
+	secret, hash, err := newSecret(keyPrefix)
+	if err != nil {
+		return err
+	}
+	scopes := make([]string, len(k.Scopes))
+	for i, s := range k.Scopes {
+		scopes[i] = string(s)
+	}
+
+	k.ID = bp.RandID()
+	k.Revoked = nil
+	err = s.db.QueryRow(`
+	INSERT INTO api_key (id_key, name, secret_hash, scopes)
+	VALUES ($1, $2, $3, $4)
+	RETURNING created_at`, k.ID.String(), k.Name, hash, pq.Array(scopes)).Scan(&k.Created)
+	if err != nil {
+		return err
+	}
+	k.Secret = secret
+	return nil
+}
+
+func (s KeyService) RotateKey(id bp.ID) (bp.APIKey, error) {
+	var k bp.APIKey
+	secret, hash, err := newSecret(keyPrefix)
+	if err != nil {
+		return k, err
+	}
+	err = scanKey(s.db.QueryRow(`
+	UPDATE api_key k SET secret_hash = $2
+	WHERE k.id_key = $1 AND k.revoked_at IS NULL
+	RETURNING `+keyColumns, id.String(), hash), &k)
+	if err == sql.ErrNoRows {
+		return k, bp.ErrNotFound
+	}
+	if err != nil {
+		return k, err
+	}
+	k.Secret = secret
+	return k, nil
+}
+
+func (s KeyService) RevokeKey(id bp.ID) error {
+	return affected(s.db.Exec(`
+	UPDATE api_key SET revoked_at = now()
+	WHERE id_key = $1 AND revoked_at IS NULL`, id.String()))
+}
+
+func (s KeyService) Authenticate(secret string) (bp.APIKey, error) {
+	var k bp.APIKey
+	err := scanKey(s.db.QueryRow(`
+	SELECT `+keyColumns+` FROM api_key k
+	WHERE k.secret_hash = $1 AND k.revoked_at IS NULL`, hashSecret(secret)), &k)
+	if err == sql.ErrNoRows {
+		return k, bp.ErrNotFound
+	}
+	return k, err
+}
@@ -0,0 +1,129 @@
+package sql
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/lib/pq"
+)
+
+var _ bp.EventSource = &Listener{}
+
+// eventChannel is the channel changes are notified on, see the
+// 0007_notify migration.
+const eventChannel = "bestprice"
+
+// subscriberBuffer is the number of events a subscriber may lag behind.
+const subscriberBuffer = 64
+
+// Listener fans the changes notified by the database out to subscribers,
+// so every server sees the changes made through the others.
+type Listener struct {
+	l *pq.Listener
+
+	mu   sync.Mutex
+	subs map[chan bp.Event]bool
+}
+
+// Listen starts listening to the changes of the database.
+func (c *Client) Listen() (*Listener, error) {
+	l := &Listener{subs: make(map[chan bp.Event]bool)}
+	l.l = pq.NewListener(c.Path, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("listener:", err)
+		}
+	})
+	if err := l.l.Listen(eventChannel); err != nil {
+		l.l.Close()
+		return nil, err
+	}
+	go l.run()
+	return l, nil
+}
+
+func (l *Listener) run() {
+	for {
+		select {
+		case n, ok := <-l.l.Notify:
+			if !ok {
+				l.mu.Lock()
+				for ch := range l.subs {
+					close(ch)
+				}
+				l.subs = nil
+				l.mu.Unlock()
+				return
+			}
+			// nil is sent after reconnecting, notifications may be lost
+			if n == nil {
+				l.publish(bp.Event{Op: bp.EventResync})
+				continue
+			}
+			var e bp.Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				log.Println("listener:", err)
+				continue
+			}
+			l.publish(e)
+		case <-time.After(90 * time.Second):
+			go l.l.Ping()
+		}
+	}
+}
+
+// publish sends e to every subscriber. A subscriber lagging behind loses
+// its oldest event and gets a resync event instead of e.
+func (l *Listener) publish(e bp.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ch := range l.subs {
+		select {
+		case ch <- e:
+			continue
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- bp.Event{Op: bp.EventResync}:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the events until Unsubscribe or
+// Close.
+func (l *Listener) Subscribe() <-chan bp.Event {
+	ch := make(chan bp.Event, subscriberBuffer)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subs == nil {
+		close(ch)
+		return ch
+	}
+	l.subs[ch] = true
+	return ch
+}
+
+// Unsubscribe stops the events of a channel returned by Subscribe and
+// closes it.
+func (l *Listener) Unsubscribe(events <-chan bp.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ch := range l.subs {
+		if ch == events {
+			delete(l.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close stops listening, the channels of the subscribers are closed.
+func (l *Listener) Close() error {
+	return l.l.Close()
+}
@@ -0,0 +1,127 @@
+package sql
+
+import (
+	"fmt"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+// Load adds the catalog of f to the database and imports its prices with
+// source. Items already present are kept as they are.
+func (c *Client) Load(f *bp.Fixture, source string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, b := range f.Brands {
+		if _, err := tx.Exec(`INSERT INTO brand (id_brand, brand_name) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, b.ID.String(), b.Name); err != nil {
+			return err
+		}
+	}
+	for _, cs := range f.Chainstores {
+		if _, err := tx.Exec(`INSERT INTO chain_store (id_chain_store, chain_store_name) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, cs.ID.String(), cs.Name); err != nil {
+			return err
+		}
+	}
+	for _, st := range f.Stores {
+		if _, err := tx.Exec(`
+		INSERT INTO store (id_store, id_chain_store, store_name, city, street_and_nr,
+		district, region, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT DO NOTHING`,
+			st.ID.String(), st.IDChainStore.String(), st.Name.NullString, st.City.NullString,
+			st.Street.NullString, st.District.NullString, st.Region.NullString,
+			st.Lat.String(), st.Lng.String()); err != nil {
+			return err
+		}
+	}
+
+	// categories and products are inserted below their parents
+	type row struct {
+		id, parent string
+		args       []interface{}
+	}
+	var rows []row
+	for _, cat := range f.Categories {
+		rows = append(rows, row{cat.ID.String(), parentID(cat.IDParent),
+			[]interface{}{cat.ID.String(), cat.Name, nullID(cat.IDParent), nil, "", nil, nil, nil}})
+	}
+	brands := make(map[string]bp.ID)
+	for _, p := range f.Products {
+		brands[p.ID.String()] = p.Brand.ID
+		rows = append(rows, row{p.ID.String(), parentID(p.IDCategory),
+			[]interface{}{p.ID.String(), p.Name, nullID(p.IDCategory), p.Brand.ID.String(), p.PriceDescription.String,
+				p.Weight.NullInt64, p.Volume.NullInt64, p.DecimalPossibility.NullBool}})
+	}
+	done := map[string]bool{"": true}
+	for len(rows) > 0 {
+		var rest []row
+		for _, r := range rows {
+			if !done[r.parent] {
+				rest = append(rest, r)
+				continue
+			}
+			if _, err := tx.Exec(`
+			INSERT INTO product (id_product, product_name, id_parent_product, id_brand,
+			price_description, weight, volume, decimal_possibility)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT DO NOTHING`, r.args...); err != nil {
+				return err
+			}
+			done[r.id] = true
+		}
+		if len(rest) == len(rows) {
+			return fmt.Errorf("%s: unknown parent %s", rest[0].id, rest[0].parent)
+		}
+		rows = rest
+	}
+
+	for _, p := range f.Promotions {
+		args := promotionArgs(&p)
+		if _, err := tx.Exec(`
+		INSERT INTO promotion (id_promotion, id_product, id_chain_store, kind,
+		price, buy, pay, percent, loyalty_card, valid_from, valid_to)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT DO NOTHING`, args...); err != nil {
+			return err
+		}
+	}
+
+	// the search index does not depend on prices, it is complete once the
+	// catalog is, see AdminService.refresh
+	if _, err := tx.Exec(`REFRESH MATERIALIZED VIEW product_search`); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	prices := make([]bp.PriceRow, len(f.Prices))
+	for i, r := range f.Prices {
+		r.Row = i + 1
+		if r.IDBrand.Null() {
+			r.IDBrand = brands[r.IDProduct.String()]
+		}
+		prices[i] = r
+	}
+	report, err := c.ImportService().ImportPrices(prices, source)
+	if err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		e := report.Errors[0]
+		return fmt.Errorf("price %d: %s", e.Row, e.Error)
+	}
+	return nil
+}
+
+func parentID(id bp.ID) string {
+	if id.Null() {
+		return ""
+	}
+	return id.String()
+}
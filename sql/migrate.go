@@ -0,0 +1,213 @@
+package sql
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrations holds the versioned schema changes, every version has a file
+// named <version>_<name>.up.sql applying it and a .down.sql reverting it.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLock is the advisory lock held while a migration runs.
+const migrationLock = 4242
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports when a migration was applied, Applied is nil for
+// pending migrations.
+type MigrationStatus struct {
+	Migration
+	Applied *time.Time
+}
+
+// Migrations returns the migrations embedded in the binary ordered by
+// version.
+func Migrations() ([]Migration, error) {
+	files, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, f := range files {
+		name := f.Name()
+		base, dir := strings.TrimSuffix(name, ".up.sql"), "up"
+		if base == name {
+			base, dir = strings.TrimSuffix(name, ".down.sql"), "down"
+		}
+		parts := strings.SplitN(base, "_", 2)
+		v, err := strconv.Atoi(parts[0])
+		if base == name || len(parts) != 2 || err != nil {
+			return nil, fmt.Errorf("migration %s: name must be <version>_<name>.up.sql or .down.sql", name)
+		}
+		b, err := migrations.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[v]
+		if !ok {
+			m = &Migration{Version: v, Name: parts[1]}
+			byVersion[v] = m
+		}
+		if dir == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	vals := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d: both up and down files are required", m.Version)
+		}
+		vals = append(vals, *m)
+	}
+	sort.Slice(vals, func(i, j int) bool { return vals[i].Version < vals[j].Version })
+	return vals, nil
+}
+
+func (c *Client) migrationTable() error {
+	_, err := c.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+// MigrationStatus lists every migration and when it was applied.
+func (c *Client) MigrationStatus() ([]MigrationStatus, error) {
+	if err := c.migrationTable(); err != nil {
+		return nil, err
+	}
+	all, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			v int
+			t time.Time
+		)
+		if err := rows.Scan(&v, &t); err != nil {
+			return nil, err
+		}
+		applied[v] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	vals := make([]MigrationStatus, len(all))
+	for i, m := range all {
+		vals[i].Migration = m
+		if t, ok := applied[m.Version]; ok {
+			vals[i].Applied = &t
+		}
+	}
+	return vals, nil
+}
+
+// migrate runs one migration in a transaction, up applies it and records
+// the version, down reverts it and forgets the version. A migration already
+// in the wanted state is skipped, so clients may migrate concurrently.
+func (c *Client) migrate(m Migration, up bool) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+		return err
+	}
+	var applied bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`,
+		m.Version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied == up {
+		return nil
+	}
+
+	script := m.Down
+	if up {
+		script = m.Up
+	}
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %d_%s: %v", m.Version, m.Name, err)
+	}
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrateUp applies every pending migration and returns the ones applied.
+func (c *Client) MigrateUp() ([]Migration, error) {
+	status, err := c.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, s := range status {
+		if s.Applied != nil {
+			continue
+		}
+		if err := c.migrate(s.Migration, true); err != nil {
+			return done, err
+		}
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the last n applied migrations and returns the ones
+// reverted.
+func (c *Client) MigrateDown(n int) ([]Migration, error) {
+	status, err := c.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(status) - 1; i >= 0 && len(done) < n; i-- {
+		if status[i].Applied == nil {
+			continue
+		}
+		if err := c.migrate(status[i].Migration, false); err != nil {
+			return done, err
+		}
+		done = append(done, status[i].Migration)
+	}
+	return done, nil
+}
@@ -0,0 +1,131 @@
+package sql
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// schema returns a client of a new empty schema of the database at
+// DATABASE_URL, created with setup and dropped after the test.
+func schema(t *testing.T, setup string) *Client {
+	raw := os.Getenv("DATABASE_URL")
+	if raw == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	name := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	admin := &Client{Path: raw}
+	if err := admin.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.db.Exec(`CREATE SCHEMA ` + name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.db.Exec(`DROP SCHEMA ` + name + ` CASCADE`)
+		admin.db.Close()
+	})
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", name+",public")
+	u.RawQuery = q.Encode()
+	c := &Client{Path: u.String()}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.db.Close() })
+	c.db.SetMaxOpenConns(1)
+	if setup != "" {
+		if _, err := c.db.Exec(setup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// legacy is the schema of databases created before migrations, product
+// prices are created by the tests.
+const legacy = `
+	CREATE TABLE brand (id_brand uuid PRIMARY KEY, brand_name text NOT NULL);
+	CREATE TABLE chain_store (id_chain_store uuid PRIMARY KEY, chain_store_name text NOT NULL UNIQUE);
+	CREATE TABLE store (
+		id_store uuid PRIMARY KEY,
+		id_chain_store uuid NOT NULL REFERENCES chain_store (id_chain_store),
+		store_name text, city text, street_and_nr text, district text, region text,
+		latitude numeric(9, 6) NOT NULL, longitude numeric(9, 6) NOT NULL
+	);
+	CREATE TABLE product (
+		id_product uuid PRIMARY KEY,
+		product_name text NOT NULL,
+		id_parent_product uuid REFERENCES product (id_product),
+		id_brand uuid REFERENCES brand (id_brand),
+		price_description text NOT NULL DEFAULT '',
+		weight integer, volume integer, decimal_possibility boolean
+	);
+	INSERT INTO brand VALUES ('20000000-0000-4000-8000-000000000001', 'Łaciate');
+	INSERT INTO chain_store VALUES ('10000000-0000-4000-8000-000000000001', 'Biedronka');
+	INSERT INTO product (id_product, product_name, id_brand, price_description)
+	VALUES ('40000000-0000-4000-8000-000000000001', 'Mleko', '20000000-0000-4000-8000-000000000001', '1 l');
+`
+
+func TestMigrateLegacy(t *testing.T) {
+	cases := []struct {
+		name   string
+		prices string
+		want   int
+	}{
+		{"table", `
+		CREATE TABLE product_prices (id_product uuid, id_chain_store uuid, unit_price numeric(10, 2));
+		INSERT INTO product_prices VALUES
+		('40000000-0000-4000-8000-000000000001', '10000000-0000-4000-8000-000000000001', 3.79);`, 1},
+		{"view", `
+		CREATE VIEW product_prices AS
+		SELECT id_product, NULL::uuid id_chain_store, NULL::numeric unit_price FROM product WHERE false;`, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := schema(t, legacy+tc.prices)
+			if _, err := c.MigrateUp(); err != nil {
+				t.Fatal(err)
+			}
+			var prices, history, view int
+			err := c.db.QueryRow(`SELECT (SELECT count(*) FROM price), (SELECT count(*) FROM price_history),
+			(SELECT count(*) FROM product_prices)`).Scan(&prices, &history, &view)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if prices != tc.want || history != tc.want || view != tc.want {
+				t.Errorf("got %d prices, %d observations and %d product_prices, want %d",
+					prices, history, view, tc.want)
+			}
+			var kind string
+			if err := c.db.QueryRow(`SELECT relkind FROM pg_class
+			WHERE relname = 'product_prices' AND relnamespace = current_schema()::regnamespace`).Scan(&kind); err != nil {
+				t.Fatal(err)
+			}
+			if kind != "v" {
+				t.Errorf("product_prices: got relkind %s, want a view", kind)
+			}
+		})
+	}
+}
+
+func TestMigrateDown(t *testing.T) {
+	c := schema(t, "")
+	up, err := c.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.MigrateDown(len(up)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+}
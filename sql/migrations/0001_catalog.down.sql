@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS product_prices;
+DROP TABLE IF EXISTS product;
+DROP TABLE IF EXISTS store;
+DROP TABLE IF EXISTS chain_store;
+DROP TABLE IF EXISTS brand;
@@ -0,0 +1,45 @@
+-- Catalog of chain stores, their stores, brands and products. Categories
+-- are products without a price description. Existing databases created
+-- before migrations keep their tables.
+CREATE TABLE IF NOT EXISTS brand (
+	id_brand uuid PRIMARY KEY,
+	brand_name text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS chain_store (
+	id_chain_store uuid PRIMARY KEY,
+	chain_store_name text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS store (
+	id_store uuid PRIMARY KEY,
+	id_chain_store uuid NOT NULL REFERENCES chain_store (id_chain_store),
+	store_name text,
+	city text,
+	street_and_nr text,
+	district text,
+	region text,
+	latitude numeric(9, 6) NOT NULL,
+	longitude numeric(9, 6) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS product (
+	id_product uuid PRIMARY KEY,
+	product_name text NOT NULL,
+	id_parent_product uuid REFERENCES product (id_product),
+	id_brand uuid REFERENCES brand (id_brand),
+	price_description text NOT NULL DEFAULT '',
+	weight integer,
+	volume integer,
+	decimal_possibility boolean
+);
+
+CREATE INDEX IF NOT EXISTS product_parent_idx ON product (id_parent_product);
+
+-- product_prices held the current prices before migrations, 0002 moves
+-- them to price.
+CREATE TABLE IF NOT EXISTS product_prices (
+	id_product uuid NOT NULL REFERENCES product (id_product),
+	id_chain_store uuid NOT NULL REFERENCES chain_store (id_chain_store),
+	unit_price numeric(10, 2) NOT NULL
+);
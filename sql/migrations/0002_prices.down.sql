@@ -0,0 +1,12 @@
+DROP VIEW product_prices;
+
+CREATE TABLE product_prices (
+	id_product uuid NOT NULL REFERENCES product (id_product),
+	id_chain_store uuid NOT NULL REFERENCES chain_store (id_chain_store),
+	unit_price numeric(10, 2) NOT NULL
+);
+INSERT INTO product_prices (id_product, id_chain_store, unit_price)
+SELECT p.id_product, p.id_chain_store, p.unit_price FROM price p;
+
+DROP TABLE price_history;
+DROP TABLE price;
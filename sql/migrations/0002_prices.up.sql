@@ -0,0 +1,48 @@
+-- Current prices of products in chain stores and every price observed.
+CREATE TABLE price (
+	id_product uuid NOT NULL REFERENCES product (id_product) ON DELETE CASCADE,
+	id_chain_store uuid NOT NULL REFERENCES chain_store (id_chain_store) ON DELETE CASCADE,
+	unit_price numeric(10, 2) NOT NULL,
+	observed_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (id_product, id_chain_store)
+);
+
+CREATE TABLE price_history (
+	id_product uuid NOT NULL REFERENCES product (id_product) ON DELETE CASCADE,
+	id_chain_store uuid NOT NULL REFERENCES chain_store (id_chain_store) ON DELETE CASCADE,
+	unit_price numeric(10, 2) NOT NULL,
+	observed_at timestamptz NOT NULL DEFAULT now(),
+	source text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX price_history_product_idx
+	ON price_history (id_product, observed_at);
+
+-- the rows of a product_prices table are moved to price and the history,
+-- the table, or the view some databases have in its place, is replaced by
+-- a view of price so every query reads the imported prices
+DO $$
+BEGIN
+	IF EXISTS (
+		SELECT 1 FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema() AND c.relname = 'product_prices' AND c.relkind = 'r'
+	) THEN
+		INSERT INTO price (id_product, id_chain_store, unit_price)
+		SELECT DISTINCT ON (pp.id_product, pp.id_chain_store) pp.id_product, pp.id_chain_store, pp.unit_price
+		FROM product_prices pp
+		ON CONFLICT DO NOTHING;
+
+		INSERT INTO price_history (id_product, id_chain_store, unit_price, source)
+		SELECT pp.id_product, pp.id_chain_store, pp.unit_price, 'product_prices'
+		FROM product_prices pp;
+
+		DROP TABLE product_prices;
+	ELSE
+		DROP VIEW IF EXISTS product_prices;
+	END IF;
+END;
+$$;
+
+CREATE VIEW product_prices AS
+SELECT p.id_product, p.id_chain_store, p.unit_price FROM price p;
@@ -0,0 +1,26 @@
+-- product_search indexes every product by its name, brand and the names
+-- of its categories, path holds the ids of the categories.
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS product_search AS
+WITH RECURSIVE nodes (id_product, path, chain) AS (
+	SELECT p.id_product, ARRAY[p.id_product], p.product_name::text
+	FROM product p
+	WHERE p.id_parent_product IS NULL
+	UNION ALL
+	SELECT p.id_product, n.path || p.id_product, n.chain || ' ' || p.product_name
+	FROM product p, nodes n
+	WHERE p.id_parent_product = n.id_product
+)
+SELECT n.id_product, n.path,
+setweight(to_tsvector('simple', unaccent(lower(p.product_name))), 'A') ||
+setweight(to_tsvector('simple', unaccent(lower(coalesce(b.brand_name, '')))), 'B') ||
+setweight(to_tsvector('simple', unaccent(lower(n.chain))), 'C') AS document
+FROM nodes n
+JOIN product p ON p.id_product = n.id_product
+LEFT JOIN brand b ON b.id_brand = p.id_brand
+WHERE p.price_description <> '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS product_search_id_idx ON product_search (id_product);
+CREATE INDEX IF NOT EXISTS product_search_document_idx ON product_search USING gin (document);
+CREATE INDEX IF NOT EXISTS product_search_path_idx ON product_search USING gin (path);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS alert_outbox;
+DROP TABLE IF EXISTS price_alert;
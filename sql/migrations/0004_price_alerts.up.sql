@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS price_alert (
+	id_alert uuid PRIMARY KEY,
+	id_product uuid NOT NULL REFERENCES product (id_product) ON DELETE CASCADE,
+	id_chain_stores uuid[] NOT NULL DEFAULT '{}',
+	target_price numeric(10, 2) NOT NULL,
+	subscriber text NOT NULL,
+	triggered boolean NOT NULL DEFAULT false,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS price_alert_subscriber_idx ON price_alert (subscriber);
+
+CREATE TABLE IF NOT EXISTS alert_outbox (
+	id_outbox bigserial PRIMARY KEY,
+	id_alert uuid NOT NULL REFERENCES price_alert (id_alert) ON DELETE CASCADE,
+	id_chain_store uuid NOT NULL REFERENCES chain_store (id_chain_store) ON DELETE CASCADE,
+	unit_price numeric(10, 2) NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	delivered_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS alert_outbox_pending_idx
+	ON alert_outbox (id_outbox) WHERE delivered_at IS NULL;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS api_key (
+	id_key uuid PRIMARY KEY,
+	name text NOT NULL,
+	secret_hash text NOT NULL UNIQUE,
+	scopes text[] NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	revoked_at timestamptz
+);
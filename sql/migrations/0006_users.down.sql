@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS shopping_list;
+DROP TABLE IF EXISTS user_session;
+DROP TABLE IF EXISTS app_user;
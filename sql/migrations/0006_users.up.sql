@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS app_user (
+	id_user uuid PRIMARY KEY,
+	email text UNIQUE,
+	password_hash text,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS user_session (
+	token_hash text PRIMARY KEY,
+	id_user uuid NOT NULL REFERENCES app_user (id_user) ON DELETE CASCADE,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS shopping_list (
+	id_list uuid PRIMARY KEY,
+	id_user uuid NOT NULL REFERENCES app_user (id_user) ON DELETE CASCADE,
+	name text NOT NULL,
+	products jsonb NOT NULL,
+	user_preference jsonb NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS shopping_list_user_idx ON shopping_list (id_user);
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS price_notify ON price;
+DROP TRIGGER IF EXISTS store_notify ON store;
+DROP TRIGGER IF EXISTS chain_store_notify ON chain_store;
+DROP TRIGGER IF EXISTS brand_notify ON brand;
+DROP TRIGGER IF EXISTS product_notify ON product;
+DROP FUNCTION IF EXISTS notify_change();
@@ -0,0 +1,43 @@
+-- Changes of the catalog and of prices are notified on the bestprice
+-- channel, the payload holds the table, the operation and the ids of the
+-- row, see bp.Event.
+CREATE OR REPLACE FUNCTION notify_change() RETURNS trigger AS $$
+DECLARE
+	r jsonb;
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		r := to_jsonb(OLD);
+	ELSE
+		r := to_jsonb(NEW);
+	END IF;
+	PERFORM pg_notify('bestprice', jsonb_strip_nulls(jsonb_build_object(
+		'table', TG_TABLE_NAME,
+		'op', lower(TG_OP),
+		'id_product', r->'id_product',
+		'id_brand', r->'id_brand',
+		'id_chain_store', r->'id_chain_store',
+		'id_store', r->'id_store'
+	))::text);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS product_notify ON product;
+CREATE TRIGGER product_notify AFTER INSERT OR UPDATE OR DELETE ON product
+	FOR EACH ROW EXECUTE PROCEDURE notify_change();
+
+DROP TRIGGER IF EXISTS brand_notify ON brand;
+CREATE TRIGGER brand_notify AFTER INSERT OR UPDATE OR DELETE ON brand
+	FOR EACH ROW EXECUTE PROCEDURE notify_change();
+
+DROP TRIGGER IF EXISTS chain_store_notify ON chain_store;
+CREATE TRIGGER chain_store_notify AFTER INSERT OR UPDATE OR DELETE ON chain_store
+	FOR EACH ROW EXECUTE PROCEDURE notify_change();
+
+DROP TRIGGER IF EXISTS store_notify ON store;
+CREATE TRIGGER store_notify AFTER INSERT OR UPDATE OR DELETE ON store
+	FOR EACH ROW EXECUTE PROCEDURE notify_change();
+
+DROP TRIGGER IF EXISTS price_notify ON price;
+CREATE TRIGGER price_notify AFTER INSERT OR UPDATE OR DELETE ON price
+	FOR EACH ROW EXECUTE PROCEDURE notify_change();
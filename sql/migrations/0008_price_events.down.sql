@@ -0,0 +1,20 @@
+CREATE OR REPLACE FUNCTION notify_change() RETURNS trigger AS $$
+DECLARE
+	r jsonb;
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		r := to_jsonb(OLD);
+	ELSE
+		r := to_jsonb(NEW);
+	END IF;
+	PERFORM pg_notify('bestprice', jsonb_strip_nulls(jsonb_build_object(
+		'table', TG_TABLE_NAME,
+		'op', lower(TG_OP),
+		'id_product', r->'id_product',
+		'id_brand', r->'id_brand',
+		'id_chain_store', r->'id_chain_store',
+		'id_store', r->'id_store'
+	))::text);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
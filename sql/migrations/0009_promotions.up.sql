@@ -0,0 +1,20 @@
+-- Promotions lower the price of a product in a chain store while valid,
+-- loyalty card ones for holders of the card of the chain store only. The
+-- columns are named as the fields of bp.Promotion.
+CREATE TABLE IF NOT EXISTS promotion (
+	id_promotion uuid PRIMARY KEY,
+	id_product uuid NOT NULL REFERENCES product (id_product) ON DELETE CASCADE,
+	id_chain_store uuid NOT NULL REFERENCES chain_store (id_chain_store) ON DELETE CASCADE,
+	kind text NOT NULL CHECK (kind IN ('price', 'multi_buy', 'nth_discount')),
+	price numeric(10, 2) CHECK (price > 0),
+	buy integer NOT NULL DEFAULT 0,
+	pay integer NOT NULL DEFAULT 0,
+	percent integer NOT NULL DEFAULT 0 CHECK (percent BETWEEN 0 AND 100),
+	loyalty_card boolean NOT NULL DEFAULT false,
+	valid_from timestamptz NOT NULL DEFAULT now(),
+	valid_to timestamptz,
+	CHECK (valid_to IS NULL OR valid_to > valid_from)
+);
+
+CREATE INDEX IF NOT EXISTS promotion_product_idx
+	ON promotion (id_product, id_chain_store);
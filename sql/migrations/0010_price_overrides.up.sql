@@ -0,0 +1,52 @@
+-- Current prices of a chain store narrowed to its stores of a region, of a
+-- district or to a single store, the most specific one matching a store
+-- applies instead of the chain wide price.
+CREATE TABLE IF NOT EXISTS price_override (
+	id_product uuid NOT NULL REFERENCES product (id_product) ON DELETE CASCADE,
+	id_chain_store uuid NOT NULL REFERENCES chain_store (id_chain_store) ON DELETE CASCADE,
+	id_store uuid REFERENCES store (id_store) ON DELETE CASCADE,
+	region text NOT NULL DEFAULT '',
+	district text NOT NULL DEFAULT '',
+	unit_price numeric(10, 2) NOT NULL,
+	observed_at timestamptz NOT NULL DEFAULT now(),
+	CHECK (id_store IS NOT NULL OR region <> '' OR district <> '')
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS price_override_scope_idx ON price_override
+	(id_product, id_chain_store, coalesce(id_store, '00000000-0000-0000-0000-000000000000'), region, district);
+
+ALTER TABLE price_history
+	ADD COLUMN IF NOT EXISTS id_store uuid,
+	ADD COLUMN IF NOT EXISTS region text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS district text NOT NULL DEFAULT '';
+
+DROP TRIGGER IF EXISTS price_override_notify ON price_override;
+CREATE TRIGGER price_override_notify AFTER INSERT OR UPDATE OR DELETE ON price_override
+	FOR EACH ROW EXECUTE PROCEDURE notify_change();
+
+-- Override events carry their scope, so they are not mistaken for the
+-- chain wide price.
+CREATE OR REPLACE FUNCTION notify_change() RETURNS trigger AS $$
+DECLARE
+	r jsonb;
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		r := to_jsonb(OLD);
+	ELSE
+		r := to_jsonb(NEW);
+	END IF;
+	PERFORM pg_notify('bestprice', jsonb_strip_nulls(jsonb_build_object(
+		'table', TG_TABLE_NAME,
+		'op', lower(TG_OP),
+		'id_product', r->'id_product',
+		'id_brand', r->'id_brand',
+		'id_chain_store', r->'id_chain_store',
+		'id_store', r->'id_store',
+		'region', nullif(r->>'region', ''),
+		'district', nullif(r->>'district', ''),
+		'unit_price', r->'unit_price',
+		'observed_at', r->'observed_at'
+	))::text);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
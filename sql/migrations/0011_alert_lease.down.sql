@@ -0,0 +1,3 @@
+ALTER TABLE alert_outbox
+	DROP COLUMN IF EXISTS leased_until,
+	DROP COLUMN IF EXISTS attempts;
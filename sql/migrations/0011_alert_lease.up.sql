@@ -0,0 +1,5 @@
+-- Outbox rows are leased to the server delivering them, the others skip
+-- them until the lease expires.
+ALTER TABLE alert_outbox
+	ADD COLUMN IF NOT EXISTS leased_until timestamptz,
+	ADD COLUMN IF NOT EXISTS attempts integer NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS user_session_user_idx;
+ALTER TABLE user_session DROP COLUMN IF EXISTS expires_at;
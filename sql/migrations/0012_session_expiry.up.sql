@@ -0,0 +1,4 @@
+-- Sessions expire, the ones started before get the lifetime of new ones.
+ALTER TABLE user_session
+	ADD COLUMN IF NOT EXISTS expires_at timestamptz NOT NULL DEFAULT now() + interval '30 days';
+CREATE INDEX IF NOT EXISTS user_session_user_idx ON user_session (id_user);
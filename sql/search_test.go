@@ -0,0 +1,76 @@
+package sql
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/BestPrice/backend/bp/bptest"
+	"github.com/shopspring/decimal"
+)
+
+var tsquery = regexp.MustCompile(`^(\pL|\pN)+:\*( \| (\pL|\pN)+:\*)*$`)
+
+func TestSearchQuery(t *testing.T) {
+	for _, phrase := range bptest.Hostile {
+		q, err := searchQuery(phrase)
+		if err != nil {
+			continue
+		}
+		if q != "" && !tsquery.MatchString(q) {
+			t.Errorf("searchQuery(%q) = %q, want words with prefix operators only", phrase, q)
+		}
+	}
+}
+
+// TestHostile sends the hostile phrases through the search and the shop
+// queries, they must neither fail nor change the catalog.
+func TestHostile(t *testing.T) {
+	s := client(t).Service()
+	all, err := s.Products(bp.ProductQuery{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cats, err := s.Categories()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, phrase := range bptest.Hostile {
+		if _, err := bp.SearchWords(phrase); err != nil {
+			continue
+		}
+		queries := []bp.ProductQuery{
+			{Phrase: phrase, Limit: 100},
+			{Phrase: phrase, Limit: 100, Sort: "unit_price"},
+		}
+		for i := range cats {
+			queries = append(queries, bp.ProductQuery{Phrase: phrase, Category: &cats[i].ID, Limit: 100})
+		}
+		for _, q := range queries {
+			vals, err := s.Products(q)
+			if err != nil {
+				t.Errorf("Products(%q): %v", phrase, err)
+				continue
+			}
+			if len(vals) == 0 {
+				continue
+			}
+			req := &bp.ShopRequest{Partial: true}
+			for _, p := range vals {
+				req.Products = append(req.Products, bp.ShopRequestProduct{ID: p.ID, Count: decimal.New(1, 0)})
+			}
+			if _, err := s.Shop(req); err != nil {
+				t.Errorf("Shop(%q): %v", phrase, err)
+			}
+		}
+	}
+
+	vals, err := s.Products(bp.ProductQuery{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != len(all) {
+		t.Errorf("Products: got %d products after hostile phrases, want %d", len(vals), len(all))
+	}
+}
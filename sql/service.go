@@ -2,23 +2,43 @@ package sql
 
 import (
 	"database/sql"
+	"encoding/json"
 	// "log"
-	"sort"
 	"strings"
-	"unicode"
-
-	"golang.org/x/text/runes"
-	"golang.org/x/text/transform"
-	"golang.org/x/text/unicode/norm"
+	"time"
 
 	"github.com/BestPrice/backend/bp"
+	"github.com/BestPrice/backend/solver"
+	"github.com/lib/pq"
 	"github.com/shopspring/decimal"
 )
 
 var _ bp.Service = &Service{}
 
 type Service struct {
-	db *sql.DB
+	db   *sql.DB
+	stmt *statements
+}
+
+// statements holds the queries of Service taking user input, prepared
+// once when the client is opened.
+type statements struct {
+	products, shop, priceHistory *sql.Stmt
+}
+
+func prepare(db *sql.DB) (*statements, error) {
+	s := new(statements)
+	for query, stmt := range map[string]**sql.Stmt{
+		productsQuery:     &s.products,
+		shopQuery:         &s.shop,
+		priceHistoryQuery: &s.priceHistory,
+	} {
+		var err error
+		if *stmt, err = db.Prepare(query); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
 func makeCategoryTree(parent *bp.ID, cat map[*bp.Category]bool) []bp.Category {
@@ -95,88 +115,66 @@ func (s Service) Chainstores() ([]bp.Chainstore, error) {
 	return vals, nil
 }
 
-func normalizePhrase(p string) (string, error) {
-	var (
-		add = func(r rune) rune {
-			if r == ' ' {
-				return '|'
-			}
-			return r
-		}
-	)
-
-	p = strings.Replace(p, "|", "", -1)
-	p = strings.TrimSpace(p)
-
-	t := transform.Chain(
-		runes.Map(add),
-		runes.Map(unicode.ToLower),
-		norm.NFD,
-		runes.Remove(runes.In(unicode.Mn)),
-		norm.NFC)
-	no, _, err := transform.String(t, p)
-	return no, err
-}
-
-func (s Service) Products(category *bp.ID, phrase string) ([]bp.Product, error) {
-
-	c := "IS NULL"
-
-	if category != nil {
-		c = "= '{" + category.String() + "}'"
-	}
-
-	p, err := normalizePhrase(phrase)
+// searchQuery returns a tsquery matching any word of the phrase by prefix.
+// Only letters and digits are kept from the phrase, see bp.SearchWords, so
+// the phrase can not inject tsquery operators.
+func searchQuery(phrase string) (string, error) {
+	words, err := bp.SearchWords(phrase)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	for i := range words {
+		words[i] += ":*"
 	}
+	return strings.Join(words, " | "), nil
+}
 
-	query := `
-		WITH RECURSIVE nodes AS (
-			-- GET all products with given category
-			SELECT p.id_product uuid, p.id_brand, p.price_description pd, ''::text || p.product_name AS chain
-			FROM product p
-			WHERE p.id_parent_product ` + c + `
-			UNION ALL
-			SELECT p.id_product, p.id_brand, p.price_description, n.chain || ' ' || p.product_name
-			FROM product p, nodes n
-			WHERE p.id_parent_product = n.uuid
-		)	, join_brands AS (
-			SELECT n.uuid, n.pd, n.chain || ' ' || b.brand_name AS chain
-			FROM nodes n
-			JOIN brand b ON b.id_brand = n.id_brand
-		), nodes2 AS (
-			-- REMOVE category products and split chain
-			SELECT n.uuid, regexp_split_to_table(n.chain, E'\\s+') words
-			FROM join_brands n
-			WHERE NOT n.pd = ''
-		), nodes3 AS (
-			-- COUNT matches
-			SELECT n.uuid uuid, count(n.uuid) rank
-			FROM nodes2 n
-			WHERE unaccent(lower(n.words)) SIMILAR TO '%(` + p + `)%'
-			GROUP BY n.uuid
-		), nodes4 AS (
-			SELECT p.*, n.rank
-			FROM product p, nodes3 n
-			WHERE p.id_product = n.uuid
-		)
+// productsQuery searches product_search, which holds the search document
+// and the category path of every product, see schema. $1 is the tsquery
+// built by searchQuery, $2 the category or NULL and $5 the bp.ProductQuery
+// sort. The unit price is computed as by bp.Product.Normalize.
+const productsQuery = `
 		SELECT
-		n.id_product,
-		n.product_name,
-		n.weight,
-		n.volume,
-		n.price_description,
-		n.decimal_possibility,
+		p.id_product,
+		p.id_parent_product,
+		p.product_name,
+		p.weight,
+		p.volume,
+		p.price_description,
+		p.decimal_possibility,
 		b.id_brand,
 		b.brand_name,
-		n.rank
-		FROM nodes4 n
-		JOIN brand b ON b.id_brand = n.id_brand
-		ORDER BY n.rank DESC
+		pp.price,
+		CASE WHEN $1 = '' THEN 0 ELSE ts_rank(ps.document, to_tsquery('simple', unaccent($1))) END rank
+		FROM product_search ps
+		JOIN product p ON p.id_product = ps.id_product
+		JOIN brand b ON b.id_brand = p.id_brand
+		LEFT JOIN LATERAL (
+			SELECT min(unit_price) price FROM product_prices WHERE id_product = p.id_product
+		) pp ON true
+		WHERE ($2::uuid IS NULL OR ps.path @> ARRAY[$2::uuid])
+		AND ($1 = '' OR ps.document @@ to_tsquery('simple', unaccent($1)))
+		ORDER BY
+		CASE WHEN $5 = 'unit_price' THEN round(pp.price / CASE
+			WHEN p.weight > 0 THEN p.weight / 1000.0
+			WHEN p.volume > 0 THEN p.volume / 1000.0
+			ELSE 1 END, 2) END NULLS LAST,
+		rank DESC, p.product_name, p.id_product
+		LIMIT $3 OFFSET $4
 	`
 
-	rows, err := s.db.Query(query)
+func (s Service) Products(q bp.ProductQuery) ([]bp.Product, error) {
+	tsq, err := searchQuery(q.Phrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var category interface{}
+	if q.Category != nil {
+		category = q.Category.String()
+	}
+
+	rows, err := s.stmt.products.Query(tsq, category, q.Limit, q.Offset, q.Sort)
 	if err != nil {
 		return nil, err
 	}
@@ -184,11 +182,15 @@ func (s Service) Products(category *bp.ID, phrase string) ([]bp.Product, error)
 
 	vals := make([]bp.Product, 0, 32)
 	for rows.Next() {
-		var p bp.Product
-		if err := rows.Scan(&p.ID, &p.Name, &p.Weight, &p.Volume, &p.PriceDescription,
-			&p.DecimalPossibility, &p.Brand.ID, &p.Brand.Name, &p.Rank); err != nil {
+		var (
+			p     bp.Product
+			price *decimal.Decimal
+		)
+		if err := rows.Scan(&p.ID, &p.IDCategory, &p.Name, &p.Weight, &p.Volume, &p.PriceDescription,
+			&p.DecimalPossibility, &p.Brand.ID, &p.Brand.Name, &price, &p.Rank); err != nil {
 			return nil, err
 		}
+		p.Normalize(price)
 		vals = append(vals, p)
 	}
 
@@ -197,7 +199,7 @@ func (s Service) Products(category *bp.ID, phrase string) ([]bp.Product, error)
 
 func (s Service) Stores() ([]bp.Store, error) {
 	query := `
-	SELECT s.id_store, cs.chain_store_name, s.store_name, s.city,
+	SELECT s.id_store, cs.id_chain_store, cs.chain_store_name, s.store_name, s.city,
 	s.street_and_nr, s.district, s.region, s.latitude, s.longitude
 	FROM store s
 	JOIN chain_store cs ON s.id_chain_store = cs.id_chain_store
@@ -211,7 +213,7 @@ func (s Service) Stores() ([]bp.Store, error) {
 	vals := make([]bp.Store, 0, 32)
 	for rows.Next() {
 		var s bp.Store
-		if err := rows.Scan(&s.ID, &s.CSName, &s.Name, &s.City, &s.Street, &s.District, &s.Region, &s.Lat, &s.Lng); err != nil {
+		if err := rows.Scan(&s.ID, &s.IDChainStore, &s.CSName, &s.Name, &s.City, &s.Street, &s.District, &s.Region, &s.Lat, &s.Lng); err != nil {
 			return nil, err
 		}
 		vals = append(vals, s)
@@ -220,176 +222,158 @@ func (s Service) Stores() ([]bp.Store, error) {
 	return vals, nil
 }
 
-func (s *Service) shopQuery(ID bp.ID) string {
-	id := ID.String()
-	query := `
+// shopQuery lists the prices of the products $1 and of every product below
+// them, chain wide and overridden in narrower scopes, with their promotions
+// valid now. Every row carries the id of the
+// requested product it belongs to, rows are ordered as the requested
+// products.
+const shopQuery = `
 WITH RECURSIVE
-t0 AS (
-	SELECT p.id_product
-	FROM product p
-	WHERE p.id_parent_product = '` + id + `'
-	UNION ALL
-	SELECT p.id_product
-	FROM product p, t0 n
-	WHERE p.id_parent_product = n.id_product
-)
-, t1 AS (
-	SELECT t.id_product FROM t0 t
-	UNION
-	SELECT '` + id + `'
+roots AS (
+	SELECT r.id_product, r.nr, r.substitutes
+	FROM unnest($1::uuid[], $2::bool[]) WITH ORDINALITY r (id_product, substitutes, nr)
 )
-, t2 AS (
-	SELECT pp.*
-	FROM t1 t, product_prices pp
-	WHERE t.id_product = pp.id_product
+, seeds (id_root, nr, id_product, substitute) AS (
+	SELECT r.id_product, r.nr, r.id_product, false FROM roots r
+	UNION ALL
+	-- similar products of the same category, see bp.Product.Similar
+	SELECT r.id_product, r.nr, s.id_product, true
+	FROM roots r
+	JOIN product o ON o.id_product = r.id_product
+	JOIN product s ON s.id_parent_product = o.id_parent_product AND s.id_product <> o.id_product
+	WHERE r.substitutes AND o.price_description <> '' AND s.price_description <> ''
+	AND (o.weight > 0 AND abs(s.weight - o.weight) * 10 <= o.weight
+		OR o.volume > 0 AND abs(s.volume - o.volume) * 10 <= o.volume)
 )
-, t3 AS (
-	SELECT '` + id + `' as id_product, cs.chain_store_name, p.product_name, b.brand_name, p.price_description, t.unit_price,
-	cs.id_chain_store
-	--, p.weight, p.volume, p.decimal_possibility
-	FROM t2 t
-	JOIN product p ON p.id_product = t.id_product
-	JOIN chain_store cs ON cs.id_chain_store = t.id_chain_store
-	JOIN brand b ON b.id_brand = p.id_brand
+, tree (id_root, nr, id_product, substitute) AS (
+	SELECT * FROM seeds
+	UNION ALL
+	SELECT t.id_root, t.nr, p.id_product, t.substitute
+	FROM product p, tree t
+	WHERE p.id_parent_product = t.id_product
 )
-SELECT * FROM t3
+SELECT t.id_root, cs.chain_store_name, p.product_name, b.brand_name, p.price_description, pp.unit_price,
+cs.id_chain_store, t.substitute, p.weight, p.volume, p.decimal_possibility,
+t.id_product, pp.id_store, pp.region, pp.district,
+(
+	SELECT json_agg(pr) FROM promotion pr
+	WHERE pr.id_product = t.id_product AND pr.id_chain_store = cs.id_chain_store
+	AND pr.valid_from <= now() AND (pr.valid_to IS NULL OR pr.valid_to > now())
+) promotions
+FROM tree t
+JOIN (
+	SELECT pp.id_product, pp.id_chain_store, pp.unit_price, NULL::uuid id_store, '' region, '' district
+	FROM product_prices pp
+	UNION ALL
+	SELECT o.id_product, o.id_chain_store, o.unit_price, o.id_store, o.region, o.district
+	FROM price_override o
+) pp ON pp.id_product = t.id_product
+JOIN product p ON p.id_product = t.id_product
+JOIN chain_store cs ON cs.id_chain_store = pp.id_chain_store
+JOIN brand b ON b.id_brand = p.id_brand
+ORDER BY t.nr
 `
-	return query
-}
 
 func (s Service) Shop(req *bp.ShopRequest) (bp.Shop, error) {
 	var (
-		IDs []string
-		p   []bp.ShopProduct
+		IDs         []string
+		substitutes []bool
+		seen        = make(map[string]bool)
 	)
 	for _, product := range req.Products {
-		IDs = append(IDs, product.ID.String())
+		if id := product.ID.String(); !seen[id] {
+			seen[id] = true
+			IDs = append(IDs, id)
+			substitutes = append(substitutes, req.Substitutes(product.ID))
+		}
+	}
 
-		rows, err := s.db.Query(s.shopQuery(product.ID))
+	rows, err := s.stmt.shop.Query(pq.Array(IDs), pq.Array(substitutes))
+	if err != nil {
+		return bp.Shop{}, err
+	}
+	defer rows.Close()
+
+	p := make([]bp.ShopProduct, 0, 8*len(IDs))
+	for rows.Next() {
+		var (
+			r              bp.ShopProduct
+			weight, volume bp.JsonNullInt64
+			weighed        bp.JsonNullBool
+			store          bp.ID
+			promotions     []byte
+		)
+		err := rows.Scan(&r.ID, &r.ChainStore, &r.Product, &r.Brand, &r.PriceDesc,
+			&r.Price, &r.IDChainStore, &r.Substitute, &weight, &volume, &weighed,
+			&r.Variant, &store, &r.Scope.Region, &r.Scope.District, &promotions)
 		if err != nil {
 			return bp.Shop{}, err
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var r bp.ShopProduct
-			err := rows.Scan(&r.ID, &r.ChainStore, &r.Product,
-				&r.Brand, &r.PriceDesc, &r.Price, &r.IDChainStore)
-			if err != nil {
+		if !store.Null() {
+			r.Scope.IDStore = &store
+		}
+		if promotions != nil {
+			if err := json.Unmarshal(promotions, &r.Promotions); err != nil {
 				return bp.Shop{}, err
 			}
-			p = append(p, r)
 		}
+		r.Quantity, r.Unit = bp.PackSize(weight, volume)
+		r.DecimalPossibility = weighed.Bool
+		p = append(p, r)
 	}
-
-	return calcShop(p, req)
-}
-
-type Stores []bp.ShopStore
-
-type shopProducts struct {
-	p []bp.ShopProduct
-}
-
-func (b *shopProducts) Len() int      { return len(b.p) }
-func (b *shopProducts) Swap(i, j int) { b.p[i], b.p[j] = b.p[j], b.p[i] }
-
-type byPrice struct {
-	shopProducts
-}
-
-func (b *byPrice) Less(i, j int) bool {
-	return b.p[i].Price.Cmp(b.p[j].Price) < 0
-}
-
-func calcShop(p []bp.ShopProduct, req *bp.ShopRequest) (bp.Shop, error) {
-
-	var (
-		stores     = make(map[string]*bp.ShopStore)
-		m          = make(map[string]bool)
-		priceTotal decimal.Decimal
-	)
-
-	// add price to products
-	for i := range p {
-		pid := p[i].ID.String()
-		m[pid] = false
-		p[i].Count = req.ProductCount(p[i].ID)
-		p[i].Price = p[i].Price.Mul(decimal.NewFromFloat(float64(p[i].Count)))
+	if err := rows.Err(); err != nil {
+		return bp.Shop{}, err
 	}
+	rows.Close()
 
-	sort.Sort(&byPrice{shopProducts{p}})
-	findProducts(p, req, stores, make(map[string]bool))
-
-	var (
-		Stores        Stores
-		productsTotal int
-	)
-	for _, store := range stores {
-		// remove not prefered chainstores
-		if !req.UserPreference.Contains(store.ID) {
-			continue
-		}
-		for _, product := range store.Products {
-			priceTotal = priceTotal.Add(product.Price)
+	var stores []bp.Store
+	if req.Location != nil {
+		if stores, err = s.Stores(); err != nil {
+			return bp.Shop{}, err
 		}
-		productsTotal += len(store.Products)
-		Stores = append(Stores, *store)
 	}
 
-	if productsTotal != len(req.Products) {
-		return bp.Shop{Error: "one or more products not available in store"}, nil
-	}
-
-	return bp.Shop{
-		Stores:     Stores,
-		PriceTotal: priceTotal,
-	}, nil
+	return solver.Shop(p, stores, req)
 }
 
-func findProducts(products []bp.ShopProduct, req *bp.ShopRequest, stores map[string]*bp.ShopStore, pt map[string]bool) {
-
-	for i, p := range products {
-		pid := p.ID.String()
-		if _, ok := pt[pid]; ok {
-			continue
-		}
-		pt[pid] = true
+// priceHistoryQuery aggregates the chain wide observations only, overrides
+// narrowed to some stores would skew the series of the chain store.
+const priceHistoryQuery = `
+	SELECT ph.id_chain_store, cs.chain_store_name,
+	date_trunc($4::text, ph.observed_at) period,
+	min(ph.unit_price), max(ph.unit_price), round(avg(ph.unit_price), 2), count(*)
+	FROM price_history ph
+	JOIN chain_store cs ON cs.id_chain_store = ph.id_chain_store
+	WHERE ph.id_product = $1 AND ph.observed_at >= $2 AND ph.observed_at < $3
+	AND ph.id_store IS NULL AND ph.region = '' AND ph.district = ''
+	GROUP BY ph.id_chain_store, cs.chain_store_name, period
+	ORDER BY cs.chain_store_name, ph.id_chain_store, period
+	`
 
-		if len(pt) > len(req.Products) {
-			delete(pt, pid)
-			return
-		}
+func (s Service) PriceHistory(product bp.ID, from, to time.Time, step bp.Aggregation) ([]bp.PriceHistory, error) {
+	rows, err := s.stmt.priceHistory.Query(product.String(), from, to, string(step))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-		pidcs := p.IDChainStore.String()
-		store := stores[pidcs]
-		if store == nil {
-			store = &bp.ShopStore{
-				ID:             p.IDChainStore,
-				ChainStoreName: p.ChainStore,
-			}
-			stores[pidcs] = store
+	vals := make([]bp.PriceHistory, 0, 8)
+	for rows.Next() {
+		var (
+			h bp.PriceHistory
+			p bp.PricePoint
+		)
+		if err := rows.Scan(&h.IDChainStore, &h.ChainStore, &p.Period,
+			&p.Min, &p.Max, &p.Avg, &p.Observations); err != nil {
+			return nil, err
 		}
-
-		if len(stores) > req.UserPreference.MaxStores {
-			delete(stores, pidcs)
-			delete(pt, pid)
+		if n := len(vals); n > 0 && vals[n-1].IDChainStore.String() == h.IDChainStore.String() {
+			vals[n-1].Prices = append(vals[n-1].Prices, p)
 			continue
 		}
-
-		store.Products = append(store.Products, p)
-
-		findProducts(products[i+1:], req, stores, pt)
-
-		if len(pt) == len(req.Products) {
-			return
-		}
-
-		store.Products = store.Products[:len(store.Products)-1]
-		if len(store.Products) == 0 {
-			delete(stores, pidcs)
-		}
-
-		delete(pt, pid)
+		h.Prices = []bp.PricePoint{p}
+		vals = append(vals, h)
 	}
+
+	return vals, rows.Err()
 }
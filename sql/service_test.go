@@ -0,0 +1,34 @@
+package sql
+
+import (
+	"os"
+	"testing"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/BestPrice/backend/bp/bptest"
+)
+
+// client returns the client of the database at DATABASE_URL loaded with
+// the fixture of bptest, the test is skipped without one. The database
+// should be dedicated to tests, rows of other catalogs fail the checks.
+func client(t *testing.T) *Client {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	c := &Client{Path: url}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Load(bp.DemoFixture(), "test"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestService(t *testing.T) {
+	c := client(t)
+	if err := bptest.TestService(c.Service()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,261 @@
+package sql
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+	"github.com/lib/pq"
+)
+
+var _ bp.UserService = &UserService{}
+
+type UserService struct {
+	db *sql.DB
+}
+
+const (
+	sessionPrefix = "bps_"
+	sessionTTL    = 30 * 24 * time.Hour
+
+	passwordIter = 600000
+	passwordSalt = 16
+	passwordKey  = 32
+)
+
+// hashPassword returns the password hashed with PBKDF2-SHA256 in the form
+// pbkdf2-sha256$iterations$salt$hash.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSalt)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIter, passwordKey)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%x$%x", passwordIter, salt, key), nil
+}
+
+// dummyHash is checked against the password of logins of unknown emails,
+// so they take as long as the ones of registered emails.
+var dummyHash = fmt.Sprintf("pbkdf2-sha256$%d$%x$%x",
+	passwordIter, make([]byte, passwordSalt), make([]byte, passwordKey))
+
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	salt, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, want) == 1
+}
+
+// session starts a new session of the user expiring after sessionTTL, the
+// expired sessions of the user are dropped.
+func (s UserService) session(u bp.User) (bp.Session, error) {
+	token, hash, err := newSecret(sessionPrefix)
+	if err != nil {
+		return bp.Session{}, err
+	}
+	if _, err := s.db.Exec(`DELETE FROM user_session WHERE id_user = $1 AND expires_at <= now()`,
+		u.ID.String()); err != nil {
+		return bp.Session{}, err
+	}
+	sess := bp.Session{Token: token, User: u}
+	err = s.db.QueryRow(`
+	INSERT INTO user_session (token_hash, id_user, expires_at)
+	VALUES ($1, $2, now() + $3::float8 * interval '1 second')
+	RETURNING expires_at`, hash, u.ID.String(), sessionTTL.Seconds()).Scan(&sess.Expires)
+	if err != nil {
+		return bp.Session{}, err
+	}
+	return sess, nil
+}
+
+func (s UserService) create(email, hash interface{}) (bp.User, error) {
+	u := bp.User{ID: bp.RandID()}
+	err := s.db.QueryRow(`
+	INSERT INTO app_user (id_user, email, password_hash) VALUES ($1, $2, $3)
+	RETURNING created_at`, u.ID.String(), email, hash).Scan(&u.Created)
+	if e, ok := err.(*pq.Error); ok && e.Code.Name() == "unique_violation" {
+		return u, bp.ConflictError("email is already registered")
+	}
+	return u, err
+}
+
+func (s UserService) Register(c bp.Credentials) (bp.Session, error) {
+	hash, err := hashPassword(c.Password)
+	if err != nil {
+		return bp.Session{}, err
+	}
+	u, err := s.create(c.Email, hash)
+	if err != nil {
+		return bp.Session{}, err
+	}
+	u.Email = c.Email
+	return s.session(u)
+}
+
+func (s UserService) RegisterDevice() (bp.Session, error) {
+	u, err := s.create(nil, nil)
+	if err != nil {
+		return bp.Session{}, err
+	}
+	return s.session(u)
+}
+
+func (s UserService) Login(c bp.Credentials) (bp.Session, error) {
+	var (
+		u    bp.User
+		hash sql.NullString
+	)
+	err := s.db.QueryRow(`
+	SELECT id_user, email, password_hash, created_at FROM app_user
+	WHERE email = $1`, c.Email).Scan(&u.ID, &u.Email, &hash, &u.Created)
+	if err == sql.ErrNoRows {
+		checkPassword(dummyHash, c.Password)
+		return bp.Session{}, bp.ErrUnauthorized
+	}
+	if err != nil {
+		return bp.Session{}, err
+	}
+	if !hash.Valid || !checkPassword(hash.String, c.Password) {
+		return bp.Session{}, bp.ErrUnauthorized
+	}
+	return s.session(u)
+}
+
+func (s UserService) Authenticate(token string) (bp.User, error) {
+	var (
+		u     bp.User
+		email sql.NullString
+	)
+	err := s.db.QueryRow(`
+	SELECT u.id_user, u.email, u.created_at
+	FROM user_session us
+	JOIN app_user u ON u.id_user = us.id_user
+	WHERE us.token_hash = $1 AND us.expires_at > now()`, hashSecret(token)).Scan(&u.ID, &email, &u.Created)
+	if err == sql.ErrNoRows {
+		return u, bp.ErrUnauthorized
+	}
+	u.Email = email.String
+	return u, err
+}
+
+func (s UserService) Logout(token string) error {
+	_, err := s.db.Exec(`DELETE FROM user_session WHERE token_hash = $1`, hashSecret(token))
+	return err
+}
+
+const listColumns = `l.id_list, l.name, l.products, l.user_preference, l.updated_at`
+
+func scanList(row scanner, l *bp.ShoppingList) error {
+	var products, pref []byte
+	if err := row.Scan(&l.ID, &l.Name, &products, &pref, &l.Updated); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(products, &l.Products); err != nil {
+		return err
+	}
+	return json.Unmarshal(pref, &l.UserPreference)
+}
+
+func (s UserService) Lists(user bp.ID) ([]bp.ShoppingList, error) {
+	rows, err := s.db.Query(`SELECT `+listColumns+` FROM shopping_list l
+	WHERE l.id_user = $1
+	ORDER BY l.name`, user.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vals := make([]bp.ShoppingList, 0, 8)
+	for rows.Next() {
+		var l bp.ShoppingList
+		if err := scanList(rows, &l); err != nil {
+			return nil, err
+		}
+		vals = append(vals, l)
+	}
+
+	return vals, rows.Err()
+}
+
+func (s UserService) List(user, id bp.ID) (bp.ShoppingList, error) {
+	var l bp.ShoppingList
+	err := scanList(s.db.QueryRow(`SELECT `+listColumns+` FROM shopping_list l
+	WHERE l.id_user = $1 AND l.id_list = $2`, user.String(), id.String()), &l)
+	if err == sql.ErrNoRows {
+		return l, bp.ErrNotFound
+	}
+	return l, err
+}
+
+func marshalList(l *bp.ShoppingList) ([]byte, []byte, error) {
+	if l.Products == nil {
+		l.Products = []bp.ShopRequestProduct{}
+	}
+	products, err := json.Marshal(l.Products)
+	if err != nil {
+		return nil, nil, err
+	}
+	pref, err := json.Marshal(l.UserPreference)
+	return products, pref, err
+}
+
+func (s UserService) CreateList(user bp.ID, l *bp.ShoppingList) error {
+	products, pref, err := marshalList(l)
+	if err != nil {
+		return err
+	}
+	l.ID = bp.RandID()
+	return s.db.QueryRow(`
+	INSERT INTO shopping_list (id_list, id_user, name, products, user_preference)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING updated_at`, l.ID.String(), user.String(), l.Name, string(products), string(pref)).Scan(&l.Updated)
+}
+
+func (s UserService) UpdateList(user bp.ID, l *bp.ShoppingList) error {
+	products, pref, err := marshalList(l)
+	if err != nil {
+		return err
+	}
+	err = s.db.QueryRow(`
+	UPDATE shopping_list SET name = $3, products = $4, user_preference = $5, updated_at = now()
+	WHERE id_user = $1 AND id_list = $2
+	RETURNING updated_at`, user.String(), l.ID.String(), l.Name, string(products), string(pref)).Scan(&l.Updated)
+	if err == sql.ErrNoRows {
+		return bp.ErrNotFound
+	}
+	return err
+}
+
+func (s UserService) DeleteList(user, id bp.ID) error {
+	return affected(s.db.Exec(`DELETE FROM shopping_list WHERE id_user = $1 AND id_list = $2`,
+		user.String(), id.String()))
+}
@@ -0,0 +1,76 @@
+package sql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BestPrice/backend/bp"
+)
+
+func TestSessions(t *testing.T) {
+	c := schema(t, "")
+	if _, err := c.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	s := c.UserService()
+
+	creds := bp.Credentials{Email: "anna@example.com", Password: "correct horse"}
+	sess, err := s.Register(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(sess.Expires); d < sessionTTL-time.Minute || d > sessionTTL {
+		t.Errorf("session expires in %s, want %s", d, sessionTTL)
+	}
+	if u, err := s.Authenticate(sess.Token); err != nil || u.Email != creds.Email {
+		t.Errorf("Authenticate: got %+v, %v, want %s", u, err, creds.Email)
+	}
+
+	// a logged out session ends, the others go on
+	other, err := s.Login(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Logout(sess.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(sess.Token); err != bp.ErrUnauthorized {
+		t.Errorf("Authenticate after Logout: got %v, want %v", err, bp.ErrUnauthorized)
+	}
+	if _, err := s.Authenticate(other.Token); err != nil {
+		t.Errorf("Authenticate of the other session: %v", err)
+	}
+
+	// an expired session ends
+	if _, err := c.db.Exec(`UPDATE user_session SET expires_at = now() - interval '1 second'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(other.Token); err != bp.ErrUnauthorized {
+		t.Errorf("Authenticate once expired: got %v, want %v", err, bp.ErrUnauthorized)
+	}
+
+	wrong := []bp.Credentials{
+		{Email: creds.Email, Password: "wrong password"},
+		{Email: "unknown@example.com", Password: creds.Password},
+	}
+	for _, c := range wrong {
+		if _, err := s.Login(c); err != bp.ErrUnauthorized {
+			t.Errorf("Login %s: got %v, want %v", c.Email, err, bp.ErrUnauthorized)
+		}
+	}
+}
+
+// TestDummyHash checks the hash of unknown emails is checked with the
+// work of a password hash and fails.
+func TestDummyHash(t *testing.T) {
+	hash, err := hashPassword("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dummyHash) != len(hash) {
+		t.Errorf("got %s, want the form of %s", dummyHash, hash)
+	}
+	if checkPassword(dummyHash, "") {
+		t.Error("the dummy hash matches the empty password")
+	}
+}